@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/fbngrm/zh-anki/pkg/cli"
+	ignore_dict "github.com/fbngrm/zh-anki/pkg/ignore"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+	"github.com/fbngrm/zh-anki/pkg/segment"
+	"golang.org/x/exp/slog"
+)
+
+// Generate short dialogues that use the target words. The words are read from the
+// -words flag or from data/<deck>/words. Dialogues are written to data/<deck>/dialogues,
+// which is the input of the normal pipeline. The file is replaced on each run, so the
+// dialogues of earlier runs are not decomposed again.
+
+var deckname string
+var targetWords string
+var perDialogue int
+var speakers int
+var hskLevel int
+var llmLanguage string
+var dryrun bool
+var llm cli.LLM
+var vocab cli.Vocab
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	flag.StringVar(&deckname, "src", "", "deckname folder name, dialogues replace the content of data/<src>/dialogues")
+	flag.StringVar(&targetWords, "words", "", "comma separated target words, defaults to the words in data/<src>/words")
+	flag.IntVar(&perDialogue, "per-dialogue", 5, "max number of target words used in a single dialogue")
+	flag.IntVar(&speakers, "speakers", 2, "number of speakers, 2 or 3")
+	vocab.Register(flag.CommandLine, true)
+	flag.IntVar(&hskLevel, "hsk-level", 0, "target hsk level of the dialogues, 0 means no level")
+	flag.StringVar(&llmLanguage, "llm-language", openai.DefaultPromptVars.Language, "language of translations")
+	flag.BoolVar(&dryrun, "dryrun", false, "print the dialogues without writing them")
+	llm.Register(flag.CommandLine)
+	flag.Parse()
+
+	if deckname == "" {
+		log.Fatal("flag -src is required")
+	}
+	if speakers < 2 || speakers > 3 {
+		log.Fatal("flag -speakers must be 2 or 3")
+	}
+	if perDialogue < 1 {
+		log.Fatal("flag -per-dialogue must be at least 1")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	words := splitWords(targetWords)
+	if len(words) == 0 {
+		words = loadWords(filepath.Join(cwd, "data", deckname, "words"))
+	}
+	if len(words) == 0 {
+		log.Fatal("no target words, use -words or add words to data/<src>/words")
+	}
+
+	// an interrupt cancels the llm requests, the dialogues generated so far are kept
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	llmProvider, ledger, err := llm.NewProvider(ctx)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	segmenter := &segment.Segmenter{
+		Cmd:   cli.SegmenterCmd,
+		Model: cli.SegmenterModel,
+	}
+	// prompt templates can be overridden per deck in data/<deck>/prompts
+	prompts, err := openai.LoadPrompts(openai.PromptVars{
+		Language: llmLanguage,
+		HSKLevel: hskLevel,
+		Examples: openai.DefaultPromptVars.Examples,
+	}, filepath.Join(cwd, "data", deckname, "prompts"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	openAIClient, err := openai.NewClient(llmProvider, openai.NewCache(cli.OpenAICacheDir), segmenter, prompts)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	vocabulary, err := vocab.NewVocabulary(ignore_dict.Load(filepath.Join(cwd, "data", "ignore")))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(words); i += perDialogue {
+		chunk := words[i:min(i+perDialogue, len(words))]
+		slog.Info("generate dialogue", "words", chunk)
+		d, err := openAIClient.GenerateDialogue(chunk, speakers, vocabulary)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			slog.Error("generate dialogue", "words", chunk, "error", err)
+			continue
+		}
+		// dialogues are separated by an empty line
+		for _, l := range d.Lines {
+			fmt.Fprintf(&sb, "%s: %s\n", l.Speaker, l.Chinese)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Print(sb.String())
+	fmt.Println(ledger.Summary())
+	if err := ledger.AppendLog(llm.UsageLog, deckname); err != nil {
+		slog.Error("append llm usage log", "error", err)
+	}
+	if dryrun || sb.Len() == 0 {
+		return
+	}
+
+	dialoguesPath := filepath.Join(cwd, "data", deckname, "dialogues")
+	if err := os.MkdirAll(filepath.Dir(dialoguesPath), os.ModePerm); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	f, err := os.Create(dialoguesPath)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(sb.String()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("dialogues written to %s\n", dialoguesPath)
+}
+
+func splitWords(s string) []string {
+	words := []string{}
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '，' }) {
+		if w = strings.TrimSpace(w); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// lines of the words file may contain a note, separated by |
+func loadWords(path string) []string {
+	words := []string{}
+	file, err := os.Open(path)
+	if err != nil {
+		return words
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(strings.SplitN(scanner.Text(), "|", 2)[0])
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
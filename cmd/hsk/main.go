@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fbngrm/zh-anki/pkg/card"
+	"github.com/fbngrm/zh-anki/pkg/char"
+	"github.com/fbngrm/zh-anki/pkg/cli"
+	"github.com/fbngrm/zh-anki/pkg/dialog"
+	"github.com/fbngrm/zh-anki/pkg/hsk"
+	ignore_dict "github.com/fbngrm/zh-anki/pkg/ignore"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+	"github.com/fbngrm/zh-anki/pkg/segment"
+	"github.com/fbngrm/zh-anki/pkg/translate"
+	"golang.org/x/exp/slog"
+)
+
+// Build all char and word cards of a HSK 3.0 level. Cards are exported in dependency
+// order: components before characters and characters before the words using them.
+
+var deckname string
+var level int
+var tags string
+var dryrun bool
+var llm cli.LLM
+var audioFlags cli.Audio
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	flag.StringVar(&deckname, "src", "", "deckname folder name (and anki deck name)")
+	flag.IntVar(&level, "level", 1, "HSK 3.0 level (1-9)")
+	flag.StringVar(&tags, "tags", "", "comma separated tags added to each note, defaults to hsk3.0 and hsk3.0::<level>")
+	flag.BoolVar(&dryrun, "dryrun", false, "print the cards in export order without exporting them")
+	llm.Register(flag.CommandLine)
+	audioFlags.Register(flag.CommandLine)
+	flag.Parse()
+
+	if level < 1 || level > 9 {
+		log.Fatalf("invalid HSK level %d, expected 1-9", level)
+	}
+	if deckname == "" {
+		log.Fatal("flag -src is required")
+	}
+	noteTags := []string{"hsk3.0", fmt.Sprintf("hsk3.0::%d", level)}
+	if tags != "" {
+		noteTags = strings.Split(tags, ",")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	targetdeck := "chinese::" + deckname
+
+	ignorePath := filepath.Join(cwd, "data", "ignore")
+	ignored := ignore_dict.Load(ignorePath)
+
+	translationsPath := filepath.Join(cwd, "data", "translations")
+	translations, err := translate.New(translationsPath, cli.IgnoreChars)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	builder, err := card.NewBuilder(cli.MnemonicsSrc)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	builder.Known = ignored
+	// the word list of the 7-9 band is not included yet, see pkg/hsk/3.0
+	if len(hsk.GetByLevel(builder.HSKDict, level)) == 0 {
+		log.Fatalf("no words for HSK level %d, add the word list of the level to pkg/hsk/3.0", level)
+	}
+
+	cards := builder.BuildLevel(level, translations)
+	tmpOutdir := filepath.Join(cwd, "data", deckname, "output")
+	if dryrun {
+		preview(cards, tmpOutdir)
+		return
+	}
+
+	// the first interrupt cancels the llm and audio requests and stops the run before
+	// the next export, the second one exits immediately
+	ctx, stop := cli.NotifyInterrupt()
+	defer stop()
+	llmProvider, ledger, err := llm.NewProvider(ctx)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	tmpAudioDir := filepath.Join(cwd, "data", deckname, "audio")
+	wordAudio, sentenceAudio, closeAudio, err := audioFlags.NewClients(ctx, tmpAudioDir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer closeAudio()
+
+	segmenter := &segment.Segmenter{
+		Cmd:   cli.SegmenterCmd,
+		Model: cli.SegmenterModel,
+	}
+	openaiCache := openai.NewCache(cli.OpenAICacheDir)
+	// prompt templates can be overridden per deck in data/<deck>/prompts
+	prompts, err := openai.LoadPrompts(openai.DefaultPromptVars, filepath.Join(cwd, "data", deckname, "prompts"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	openAIClient, err := openai.NewClient(llmProvider, openaiCache, segmenter, prompts)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	charProcessor := char.Processor{
+		IgnoreChars: cli.IgnoreChars,
+		Audio:       wordAudio,
+		WordIndex:   builder.WordIndex,
+		CardBuilder: builder,
+		MediaDir:    tmpAudioDir,
+	}
+	wordProcessor := dialog.WordProcessor{
+		Chars:         charProcessor,
+		Audio:         wordAudio,
+		SentenceAudio: sentenceAudio,
+		IgnoreChars:   cli.IgnoreChars,
+		WordIndex:     builder.WordIndex,
+		CardBuilder:   builder,
+		Client:        openAIClient,
+	}
+
+	words := []dialog.Word{}
+	for _, c := range cards {
+		// hsk entries are words, even if they consist of a single character
+		if _, ok := c.DictEntries["hsk"]; !ok && utf8.RuneCountInString(c.SimplifiedChinese) == 1 {
+			cli.ExitIfInterrupted(ctx)
+			for _, ch := range charProcessor.GetAll(c.SimplifiedChinese, true, translations) {
+				ch.Tags = noteTags
+				if err := char.Export(targetdeck, ch, ignored); err != nil {
+					slog.Error("export char", "char", ch.Chinese, "error", err)
+				}
+			}
+			continue
+		}
+		w, err := wordProcessor.Decompose(dialog.Word{Chinese: c.SimplifiedChinese}, translations, false)
+		if err != nil {
+			slog.Error("decompose", "word", c.SimplifiedChinese, "error", err)
+			continue
+		}
+		cli.ExitIfInterrupted(ctx)
+		w.Tags = noteTags
+		for i := range w.Chars {
+			w.Chars[i].Tags = noteTags
+		}
+		if err := dialog.ExportWord(targetdeck, *w, ignored); err != nil {
+			slog.Error("export word", "word", w.Chinese, "error", err)
+		}
+		words = append(words, *w)
+	}
+	wordProcessor.ExportJSON(words, tmpOutdir)
+
+	// write newly ignored words
+	ignored.Write(ignorePath)
+
+	fmt.Println(ledger.Summary())
+	if err := ledger.AppendLog(llm.UsageLog, deckname); err != nil {
+		slog.Error("append llm usage log", "error", err)
+	}
+}
+
+type previewCard struct {
+	Chinese string `json:"chinese"`
+	Kind    string `json:"kind"`
+	Pinyin  string `json:"pinyin"`
+	English string `json:"english"`
+}
+
+// print the cards in export order and write them to a JSON file in the output dir.
+func preview(cards []*card.Card, outDir string) {
+	previews := make([]previewCard, len(cards))
+	for i, c := range cards {
+		kind := "word"
+		if _, ok := c.DictEntries["hsk"]; !ok && utf8.RuneCountInString(c.SimplifiedChinese) == 1 {
+			kind = "char"
+		}
+		pinyin, english := "", ""
+		for _, src := range []string{"hsk", "cedict", "heisig", "components"} {
+			for _, e := range c.DictEntries[src] {
+				pinyin, english = e.Pinyin, e.English
+				break
+			}
+			if english != "" {
+				break
+			}
+		}
+		previews[i] = previewCard{
+			Chinese: c.SimplifiedChinese,
+			Kind:    kind,
+			Pinyin:  pinyin,
+			English: english,
+		}
+		fmt.Printf("%4d %s %s %s %s\n", i+1, kind, c.SimplifiedChinese, pinyin, english)
+	}
+
+	if err := os.MkdirAll(outDir, os.ModePerm); err != nil {
+		fmt.Println("create export dir: ", err.Error())
+		os.Exit(1)
+	}
+	b, err := json.MarshalIndent(previews, "", "    ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	outPath := filepath.Join(outDir, fmt.Sprintf("hsk-%d.json", level))
+	if err := os.WriteFile(outPath, b, 0644); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d cards, preview written to %s\n", len(cards), outPath)
+}
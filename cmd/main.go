@@ -3,39 +3,30 @@ package main
 import (
 	"flag"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 
-	"github.com/fbngrm/zh-anki/pkg/audio"
 	"github.com/fbngrm/zh-anki/pkg/card"
 	"github.com/fbngrm/zh-anki/pkg/char"
+	"github.com/fbngrm/zh-anki/pkg/cli"
 	"github.com/fbngrm/zh-anki/pkg/dialog"
-	"github.com/fbngrm/zh-anki/pkg/frequency"
 	ignore_dict "github.com/fbngrm/zh-anki/pkg/ignore"
 	"github.com/fbngrm/zh-anki/pkg/openai"
 	"github.com/fbngrm/zh-anki/pkg/segment"
 	"github.com/fbngrm/zh-anki/pkg/translate"
+	"github.com/fbngrm/zh-anki/pkg/verify"
 	"golang.org/x/exp/slog"
 )
 
-const wordFrequencySrc = "./pkg/frequency/global_wordfreq.release_UTF-8.txt"
-
-const mnemonicsSrc = "/home/f/Dropbox/zh/mnemonics/mnemonics.txt"
-
-const segmenterCmd = "/home/f/work/src/github.com/fbngrm/stanford-segmenter/segment.sh"
-const segmenterModel = "pku"
-
-// here we store responses from openai, the tmp output dir will be copied here in the Make target
-const openaiCacheDir = "/home/f/Dropbox/zh/cache/openai"
-
-// here we store generated audio, the tmp output dir will be copied here in the Make target
-const audioCacheDir = "/home/f/Dropbox/zh/cache/audio"
-
-var ignoreChars = []string{"!", "！", "？", "?", "，", ",", ".", "。", "", " ", "、"}
-
 var deckname string
 var dryrun bool
+var concurrency int
+var hskLevel int
+var llmLanguage string
+var examples int
+var llm cli.LLM
+var audioFlags cli.Audio
+var vocab cli.Vocab
 
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
@@ -43,23 +34,27 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
-	openAIApiKey := os.Getenv("OPENAI_API_KEY")
-	if openAIApiKey == "" {
-		log.Fatal("Environment variable OPENAI_API_KEY is not set")
-	}
-	azureApiKey := os.Getenv("SPEECH_KEY")
-	if azureApiKey == "" {
-		log.Fatal("Environment variable SPEECH_KEY is not set")
-	}
-	azureEndpoint := os.Getenv("AZURE_ENDPOINT")
-	if azureEndpoint == "" {
-		log.Fatal("Environment variable AZURE_ENDPOINT is not set")
-	}
-
 	flag.StringVar(&deckname, "src", "", "deckname folder name (and anki deck name if target is empty)")
 	flag.BoolVar(&dryrun, "dryrun", false, "perform a dry run (no actual export, only JSON export)")
+	llm.Register(flag.CommandLine)
+	flag.IntVar(&concurrency, "concurrency", 4, "number of words, sentences and clozes processed in parallel")
+	vocab.Register(flag.CommandLine, false)
+	flag.IntVar(&hskLevel, "hsk-level", 0, "target hsk level of example sentences, 0 means no level")
+	flag.IntVar(&examples, "examples", openai.DefaultPromptVars.Examples, "number of example sentences per word or grammar pattern")
+	flag.StringVar(&llmLanguage, "llm-language", openai.DefaultPromptVars.Language, "language of translations and explanations")
+	audioFlags.Register(flag.CommandLine)
 	flag.Parse()
 
+	// the first interrupt cancels the llm and audio requests and stops the run before
+	// the next export, the second one exits immediately
+	ctx, stop := cli.NotifyInterrupt()
+	defer stop()
+	llmProvider, ledger, err := llm.NewProvider(ctx)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	cwd, err := os.Getwd()
 	if err != nil {
 		fmt.Println(err)
@@ -72,79 +67,99 @@ func main() {
 	ignored := ignore_dict.Load(ignorePath)
 
 	translationsPath := filepath.Join(cwd, "data", "translations")
-	translations, err := translate.New(translationsPath, ignoreChars)
+	translations, err := translate.New(translationsPath, cli.IgnoreChars)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
-	// here we store generated audio files, that are then copied to anki media dir and the audio cache
+	// here we store generated audio files, that are then copied to the anki media dir
 	tmpAudioDir := filepath.Join(cwd, "data", deckname, "audio")
-	audioCache := &audio.Cache{
-		SrcDir: audioCacheDir,
-		DstDir: tmpAudioDir,
-	}
-	azureClient := audio.NewAzureClient(
-		azureEndpoint, azureApiKey, tmpAudioDir, ignoreChars, audioCache)
-	gcpClient := &audio.GCPClient{
-		Cache:       audioCache,
-		IgnoreChars: ignoreChars,
-		AudioDir:    tmpAudioDir,
-	}
-
-	wordIndex, err := frequency.NewWordIndex(wordFrequencySrc)
+	wordAudio, sentenceAudio, closeAudio, err := audioFlags.NewClients(ctx, tmpAudioDir)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	defer closeAudio()
 
-	builder, err := card.NewBuilder(mnemonicsSrc)
+	builder, err := card.NewBuilder(cli.MnemonicsSrc)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	// confusables and homophones are only shown for characters we already know
+	builder.Known = ignored
 
 	segmenter := &segment.Segmenter{
-		Cmd:   segmenterCmd,
-		Model: segmenterModel,
+		Cmd:   cli.SegmenterCmd,
+		Model: cli.SegmenterModel,
 	}
 
 	// we cache responses from openai api
-	openaiCache := openai.NewCache(openaiCacheDir)
-	openAIClient, err := openai.NewClient(openAIApiKey, openaiCache, segmenter)
+	openaiCache := openai.NewCache(cli.OpenAICacheDir)
+	// prompt templates can be overridden per deck in data/<deck>/prompts
+	prompts, err := openai.LoadPrompts(openai.PromptVars{
+		Language: llmLanguage,
+		HSKLevel: hskLevel,
+		Examples: examples,
+	}, filepath.Join(cwd, "data", deckname, "prompts"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	openAIClient, err := openai.NewClient(llmProvider, openaiCache, segmenter, prompts)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// words missing from hsk and cedict, e.g. slang or names, are looked up with the llm
+	builder.Fallback = openAIClient
+
+	vocabulary, err := vocab.NewVocabulary(ignored)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
 	charProcessor := char.Processor{
-		IgnoreChars: ignoreChars,
-		Audio:       gcpClient,
-		WordIndex:   wordIndex,
+		IgnoreChars: cli.IgnoreChars,
+		Audio:       wordAudio,
+		WordIndex:   builder.WordIndex,
 		CardBuilder: builder,
+		MediaDir:    tmpAudioDir,
 	}
 	wordProcessor := dialog.WordProcessor{
-		Chars:       charProcessor,
-		GCPAudio:    gcpClient,
-		AzureAudio:  azureClient,
-		IgnoreChars: ignoreChars,
-		WordIndex:   wordIndex,
-		CardBuilder: builder,
-		Client:      openAIClient,
-	}
+		Chars:         charProcessor,
+		Audio:         wordAudio,
+		SentenceAudio: sentenceAudio,
+		IgnoreChars:   cli.IgnoreChars,
+		WordIndex:     builder.WordIndex,
+		CardBuilder:   builder,
+		Client:        openAIClient,
+		Concurrency:   concurrency,
+		Vocabulary:    vocabulary,
+	}
+	// pinyin and segmentation of the LLM are cross-checked against CEDICT
+	verifier := verify.NewVerifier(builder.CedictDict)
+
 	sentenceProcessor := dialog.SentenceProcessor{
-		Client: openAIClient,
-		Words:  wordProcessor,
-		Audio:  azureClient,
+		Client:      openAIClient,
+		Words:       wordProcessor,
+		Audio:       sentenceAudio,
+		Concurrency: concurrency,
+		Verifier:    verifier,
 	}
 	clozeProcessor := dialog.ClozeProcessor{
-		Client: openAIClient,
-		Words:  wordProcessor,
-		Audio:  azureClient,
+		Client:      openAIClient,
+		Words:       wordProcessor,
+		Audio:       sentenceAudio,
+		Concurrency: concurrency,
+		Verifier:    verifier,
 	}
 	grammarProcessor := dialog.GrammarProcessor{
-		Client: openAIClient,
-		Audio:  azureClient,
+		Client:     openAIClient,
+		Audio:      sentenceAudio,
+		Vocabulary: vocabulary,
 	}
 
 	tmpOutdir := filepath.Join(cwd, "data", deckname, "output")
@@ -153,6 +168,18 @@ func main() {
 	sentencePath := filepath.Join(cwd, "data", deckname, "sentences")
 	if _, err := os.Stat(sentencePath); err == nil {
 		sentences := sentenceProcessor.DecomposeFromFile(sentencePath, tmpOutdir, translations, dryrun)
+		cli.ExitIfInterrupted(ctx)
+		if dryrun {
+			sentenceProcessor.ExportJSON(sentences, tmpOutdir)
+		} else {
+			sentenceProcessor.Export(sentences, tmpOutdir, targetdeck, ignored)
+		}
+	}
+	// load dialogues from file, e.g. written by cmd/generate-dialogue
+	dialoguePath := filepath.Join(cwd, "data", deckname, "dialogues")
+	if _, err := os.Stat(dialoguePath); err == nil {
+		sentences := sentenceProcessor.DecomposeDialoguesFromFile(dialoguePath, tmpOutdir, translations, dryrun)
+		cli.ExitIfInterrupted(ctx)
 		if dryrun {
 			sentenceProcessor.ExportJSON(sentences, tmpOutdir)
 		} else {
@@ -167,6 +194,7 @@ func main() {
 			slog.Error("decompose cloze", "error", err)
 			os.Exit(1)
 		}
+		cli.ExitIfInterrupted(ctx)
 		if dryrun {
 			clozeProcessor.ExportJSON(clozes, tmpOutdir)
 		} else {
@@ -177,6 +205,7 @@ func main() {
 	wordPath := filepath.Join(cwd, "data", deckname, "words")
 	if _, err := os.Stat(wordPath); err == nil {
 		words := wordProcessor.DecomposeFromFile(wordPath, tmpOutdir, translations, dryrun)
+		cli.ExitIfInterrupted(ctx)
 		if dryrun {
 			wordProcessor.ExportJSON(words, tmpOutdir)
 		} else {
@@ -191,8 +220,25 @@ func main() {
 			fmt.Println(err)
 			os.Exit(1)
 		}
+		cli.ExitIfInterrupted(ctx)
 		grammarProcessor.Export(grammar, tmpOutdir, targetdeck)
 	}
 	// write newly ignored words
 	ignored.Write(ignorePath)
+
+	if issues := verifier.Issues(); len(issues) > 0 {
+		reportPath := filepath.Join(tmpOutdir, "pinyin-report.txt")
+		if err := os.MkdirAll(tmpOutdir, os.ModePerm); err != nil {
+			slog.Error("create output dir", "error", err)
+		} else if err := verifier.WriteReport(reportPath); err != nil {
+			slog.Error("write pinyin report", "error", err)
+		} else {
+			fmt.Printf("%d pinyin issues, see %s\n", len(issues), reportPath)
+		}
+	}
+
+	fmt.Println(ledger.Summary())
+	if err := ledger.AppendLog(llm.UsageLog, deckname); err != nil {
+		slog.Error("append llm usage log", "error", err)
+	}
 }
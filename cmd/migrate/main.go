@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/fbngrm/zh-anki/pkg/anki"
+	"github.com/fbngrm/zh-anki/pkg/audio"
+	"github.com/fbngrm/zh-anki/pkg/cli"
+	"github.com/fbngrm/zh-anki/pkg/media"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+	"golang.org/x/exp/slog"
+)
+
+// One-off migrations of caches and media files to new formats.
+
+// the card JSON copied by make cp-json
+const jsonCacheDir = "/home/f/Dropbox/zh/cache/cards"
+
+var openaiCache bool
+var openaiCacheSrc string
+var openaiCacheDst string
+var openaiModel string
+var audioNames bool
+var audioCache string
+var ankiQuery string
+var jsonNames bool
+var jsonCache string
+var dry bool
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	flag.BoolVar(&openaiCache, "openai-cache", false, "import the flat openai cache files, named after the query, into the hash keyed cache")
+	flag.StringVar(&openaiCacheSrc, "openai-cache-src", cli.OpenAICacheDir, "dir of the legacy openai cache files")
+	flag.StringVar(&openaiCacheDst, "openai-cache-dst", cli.OpenAICacheDir, "dir of the hash keyed openai cache")
+	flag.StringVar(&openaiModel, "openai-model", openai.DefaultModel, "model that was used to fetch the legacy responses")
+	flag.BoolVar(&audioNames, "audio-names", false, "rename the audio files named after the text in the cache and in anki notes to the hash suffixed names")
+	flag.StringVar(&audioCache, "audio-cache", cli.AudioCacheDir, "dir of the audio cache")
+	flag.StringVar(&ankiQuery, "anki-query", `deck:"chinese::*"`, "anki search query for notes with audio to rename")
+	flag.BoolVar(&jsonNames, "json-names", false, "rename the card JSON files named after the text to the hash suffixed names")
+	flag.StringVar(&jsonCache, "json-cache", jsonCacheDir, "dir of the card JSON, with a sub dir per card type")
+	flag.BoolVar(&dry, "dry", false, "print what would be migrated, without changes")
+	flag.Parse()
+
+	if !openaiCache && !audioNames && !jsonNames {
+		fmt.Println("nothing to migrate, see -help")
+		os.Exit(1)
+	}
+
+	if openaiCache {
+		// entries get the versions of the default prompts
+		prompts, err := openai.LoadPrompts(openai.DefaultPromptVars)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		n, err := openai.MigrateLegacyCache(openaiCacheSrc, openai.NewCache(openaiCacheDst), prompts, openaiModel)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("migrated %d openai cache entries to %s\n", n, openaiCacheDst)
+	}
+
+	if audioNames {
+		cache, err := audio.NewCache(audioCache)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		renamed, err := cache.MigrateLegacyNames(dry)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("renamed %d audio cache files in %s\n", len(renamed), audioCache)
+		n, err := anki.RenameSounds(ankiQuery, renameAudio, dry)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("renamed the audio of %d anki notes\n", n)
+	}
+
+	if jsonNames {
+		n, err := renameJSON(jsonCache, dry)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("renamed %d card JSON files in %s\n", n, jsonCache)
+	}
+}
+
+// renameJSON renames the JSON files in dir and its sub dirs. A file that exists by the
+// new name already is newer, the old file is removed then.
+func renameJSON(dir string, dry bool) (int, error) {
+	n := 0
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		newName, ok := media.Rename(d.Name())
+		if !ok {
+			return nil
+		}
+		n++
+		newPath := filepath.Join(filepath.Dir(path), newName)
+		slog.Info("rename card json", "from", path, "to", newPath)
+		if dry {
+			return nil
+		}
+		if _, err := os.Stat(newPath); err == nil {
+			return os.Remove(path)
+		}
+		return os.Rename(path, newPath)
+	})
+	return n, err
+}
+
+// only audio is named after the text, stroke order diagrams keep their names
+func renameAudio(filename string) (string, bool) {
+	if filepath.Ext(filename) != ".mp3" {
+		return "", false
+	}
+	return media.Rename(filename)
+}
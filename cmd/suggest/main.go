@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fbngrm/zh-anki/pkg/cli"
+	"github.com/fbngrm/zh-anki/pkg/frequency"
+	"github.com/fbngrm/zh-anki/pkg/hsk"
+	ignore_dict "github.com/fbngrm/zh-anki/pkg/ignore"
+	"github.com/fbngrm/zh-anki/pkg/suggest"
+	"golang.org/x/exp/slog"
+)
+
+// Suggest the next words to learn. Known words are read from the ignore list and/or
+// the notes in Anki. Suggestions are appended to data/<deck>/words, which is the
+// input of the normal pipeline.
+
+const wordFrequencySrc = "./pkg/frequency/global_wordfreq.release_UTF-8.txt"
+
+const hskSrc = "./pkg/hsk/3.0"
+
+var deckname string
+var count int
+var depth int
+var maxUnknown int
+var fromIgnore bool
+var fromAnki bool
+var query string
+var dryrun bool
+
+func main() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	flag.StringVar(&deckname, "src", "", "deckname folder name, suggestions are written to data/<src>/words")
+	flag.IntVar(&count, "n", 20, "number of words to suggest")
+	flag.IntVar(&depth, "depth", 20000, "number of most frequent words considered, hsk words are always considered")
+	flag.IntVar(&maxUnknown, "max-unknown", 1, "max number of unknown characters per word")
+	flag.BoolVar(&fromIgnore, "ignore", true, "read known words from the ignore list")
+	flag.BoolVar(&fromAnki, "anki", false, "read known words from the notes in anki (requires AnkiConnect)")
+	flag.StringVar(&query, "query", `deck:"chinese::*"`, "anki search query for known notes")
+	flag.BoolVar(&dryrun, "dryrun", false, "print the suggestions without writing them")
+	flag.Parse()
+
+	if deckname == "" {
+		log.Fatal("flag -src is required")
+	}
+	if !fromIgnore && !fromAnki {
+		log.Fatal("no known words source, use -ignore and/or -anki")
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	known := make(map[string]struct{})
+	if fromIgnore {
+		for k := range ignore_dict.Load(filepath.Join(cwd, "data", "ignore")) {
+			known[k] = struct{}{}
+		}
+	}
+	if fromAnki {
+		words, err := cli.LoadFromAnki(query)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, w := range words {
+			known[w] = struct{}{}
+		}
+	}
+	slog.Info("known words", "count", len(known))
+
+	wordIndex, err := frequency.NewWordIndex(wordFrequencySrc)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	hskDict, err := hsk.NewDict(hskSrc)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	suggester := suggest.Suggester{
+		WordIndex:  wordIndex,
+		HSKDict:    hskDict,
+		Depth:      depth,
+		MaxUnknown: maxUnknown,
+	}
+	wordsPath := filepath.Join(cwd, "data", deckname, "words")
+	queued := loadQueued(wordsPath)
+	for w := range queued {
+		known[w] = struct{}{}
+	}
+
+	suggestions := suggester.Suggest(known, count)
+	for i, s := range suggestions {
+		fmt.Printf("%4d %s unknown=%d hsk=%s rank=%d\n", i+1, s.Word, s.Unknown, s.HSKLevel, s.Rank)
+	}
+	if dryrun || len(suggestions) == 0 {
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(wordsPath), os.ModePerm); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	f, err := os.OpenFile(wordsPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	for _, s := range suggestions {
+		if _, err := fmt.Fprintln(f, s.Word); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("%d words appended to %s\n", len(suggestions), wordsPath)
+}
+
+// words already in the words file are not suggested again
+func loadQueued(path string) map[string]struct{} {
+	queued := make(map[string]struct{})
+	file, err := os.Open(path)
+	if err != nil {
+		return queued
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// lines may contain a note, separated by |
+		word := strings.TrimSpace(strings.SplitN(scanner.Text(), "|", 2)[0])
+		if word != "" {
+			queued[word] = struct{}{}
+		}
+	}
+	return queued
+}
@@ -30,7 +30,10 @@ type Response struct {
 }
 
 // AddNoteToDeck adds a new note to the specified deck in Anki
-func AddNoteToDeck(deckName, modelName string, noteFields map[string]string) (int, error) {
+func AddNoteToDeck(deckName, modelName string, noteFields map[string]string, tags ...string) (int, error) {
+	if tags == nil {
+		tags = []string{}
+	}
 	// Create a new note with the provided fields
 	note := Note{
 		DeckName:  deckName,
@@ -41,7 +44,7 @@ func AddNoteToDeck(deckName, modelName string, noteFields map[string]string) (in
 		}{
 			AllowDuplicate: false,
 		},
-		Tags: []string{},
+		Tags: tags,
 	}
 
 	// Prepare the request payload
@@ -154,3 +157,74 @@ func UpdateNoteInDeck(noteID string, noteFields map[string]string) error {
 
 	return fmt.Errorf("failed to update note. Status code: %d", response.StatusCode)
 }
+
+// NoteInfo holds the fields and tags of a note as returned by notesInfo
+type NoteInfo struct {
+	NoteID    int64                `json:"noteId"`
+	ModelName string               `json:"modelName"`
+	Tags      []string             `json:"tags"`
+	Fields    map[string]NoteField `json:"fields"`
+}
+
+type NoteField struct {
+	Value string `json:"value"`
+	Order int    `json:"order"`
+}
+
+// FindNotes returns the ids of all notes matching the query, e.g. deck:"chinese::zh"
+func FindNotes(query string) ([]int64, error) {
+	var ids []int64
+	if err := request("findNotes", map[string]string{"query": query}, &ids); err != nil {
+		return nil, fmt.Errorf("failed to find notes: %w", err)
+	}
+	return ids, nil
+}
+
+// NotesInfo returns the fields and tags of the notes with the given ids
+func NotesInfo(ids []int64) ([]NoteInfo, error) {
+	var notes []NoteInfo
+	if err := request("notesInfo", map[string][]int64{"notes": ids}, &notes); err != nil {
+		return nil, fmt.Errorf("failed to get notes info: %w", err)
+	}
+	return notes, nil
+}
+
+// request sends an action to AnkiConnect and decodes the result into result
+func request(action string, params interface{}, result interface{}) error {
+	payload := struct {
+		Action  string      `json:"action"`
+		Version int         `json:"version"`
+		Params  interface{} `json:"params"`
+	}{
+		Action:  action,
+		Version: 6,
+		Params:  params,
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := http.Post(ankiConnectURL, "application/json", bytes.NewReader(payloadBytes))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code: %d", response.StatusCode)
+	}
+
+	var responseData struct {
+		Result json.RawMessage `json:"result"`
+		Error  *string         `json:"error"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&responseData); err != nil {
+		return err
+	}
+	if responseData.Error != nil && *responseData.Error != "" {
+		return errors.New(*responseData.Error)
+	}
+	return json.Unmarshal(responseData.Result, result)
+}
@@ -0,0 +1,115 @@
+package anki
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/exp/slog"
+)
+
+// RetrieveMediaFile returns the base64 encoded content of a file in the media dir, false
+// if the file does not exist.
+func RetrieveMediaFile(filename string) (string, bool, error) {
+	// the result is false for missing files
+	var result json.RawMessage
+	if err := request("retrieveMediaFile", map[string]string{"filename": filename}, &result); err != nil {
+		return "", false, fmt.Errorf("failed to retrieve media file %s: %w", filename, err)
+	}
+	var data string
+	if err := json.Unmarshal(result, &data); err != nil {
+		return "", false, nil
+	}
+	return data, true, nil
+}
+
+// StoreMediaFile writes the base64 encoded data to the media dir.
+func StoreMediaFile(filename, data string) error {
+	var result string
+	if err := request("storeMediaFile", map[string]string{"filename": filename, "data": data}, &result); err != nil {
+		return fmt.Errorf("failed to store media file %s: %w", filename, err)
+	}
+	return nil
+}
+
+var soundTag = regexp.MustCompile(`\[sound:([^\]]+)\]`)
+
+// RenameSounds replaces the filenames of the [sound:] tags in the notes matching query,
+// rename returns false for names to keep. The media files are copied to the new names,
+// the old files are removed by Tools > Check Media in anki once they are unused. Returns
+// the number of updated notes, nothing is changed in a dry run.
+func RenameSounds(query string, rename func(string) (string, bool), dry bool) (int, error) {
+	ids, err := FindNotes(query)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	notes, err := NotesInfo(ids)
+	if err != nil {
+		return 0, err
+	}
+	// media files shared by several notes are copied once
+	copied := make(map[string]bool)
+	count := 0
+	for _, note := range notes {
+		renamed := make(map[string]string)
+		fields := make(map[string]string)
+		for name, field := range note.Fields {
+			value := soundTag.ReplaceAllStringFunc(field.Value, func(tag string) string {
+				filename := soundTag.FindStringSubmatch(tag)[1]
+				newName, ok := rename(filename)
+				if !ok {
+					return tag
+				}
+				renamed[filename] = newName
+				return GetAudioPath(newName)
+			})
+			if value != field.Value {
+				fields[name] = value
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		count++
+		for filename, newName := range renamed {
+			slog.Info("rename sound", "note", note.NoteID, "from", filename, "to", newName)
+		}
+		if dry {
+			continue
+		}
+		for filename, newName := range renamed {
+			if copied[filename] {
+				continue
+			}
+			data, ok, err := RetrieveMediaFile(filename)
+			if err != nil {
+				return count, err
+			}
+			if !ok {
+				slog.Warn("missing media file", "filename", filename, "note", note.NoteID)
+			} else if err := StoreMediaFile(newName, data); err != nil {
+				return count, err
+			}
+			copied[filename] = true
+		}
+		if err := updateNoteFields(note.NoteID, fields); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// updateNoteFields sets the given fields, other fields of the note are kept.
+func updateNoteFields(id int64, fields map[string]string) error {
+	params := map[string]interface{}{
+		"note": map[string]interface{}{"id": id, "fields": fields},
+	}
+	var result interface{}
+	if err := request("updateNoteFields", params, &result); err != nil {
+		return fmt.Errorf("failed to update note %d: %w", id, err)
+	}
+	return nil
+}
@@ -3,178 +3,118 @@ package audio
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/fbngrm/zh-anki/pkg/retry"
 	"golang.org/x/exp/slog"
-	"golang.org/x/net/http2"
 )
 
-// speed
-const rate = "0.7"
-const maxRetries = 10
-
-type AzureClient struct {
-	cache       *Cache
-	endpoint    string
-	apiKey      string
-	AudioDir    string
-	ignoreChars []string
-}
-
-func NewAzureClient(endpoint, apiKey, audioDir string, ignoreChars []string, cache *Cache) *AzureClient {
-	return &AzureClient{
-		endpoint:    endpoint,
-		apiKey:      apiKey,
-		AudioDir:    audioDir,
-		ignoreChars: ignoreChars,
-		cache:       cache,
-	}
+// the backoff of azure and gcp, quota errors need a long breath
+var backoff = retry.Backoff{
+	Attempts: 8,
+	Base:     2 * time.Second,
+	Max:      time.Minute,
 }
 
-// we support 4 different voices only
-var Voices = []string{
-	"zh-CN-XiaoxiaoNeural", // female
-	"zh-CN-YunjianNeural",  // male
-	"zh-CN-XiaochenNeural", // female
-	// "zh-CN-YinyangNeural",  // male / broken
-	"zh-CN-YunyiMultilingualNeural", // male
+// Azure synthesizes speech with the azure text-to-speech api. The http client is
+// shared by all requests, so connections are reused.
+type Azure struct {
+	endpoint   string
+	apiKey     string
+	backoff    retry.Backoff
+	httpClient *http.Client
 }
 
-func (c *AzureClient) GetRandomVoice() string {
-	rand.Seed(time.Now().UnixNano()) // initialize global pseudo random generator
-	return Voices[rand.Intn(len(Voices))]
+func NewAzure(endpoint, apiKey string) *Azure {
+	return &Azure{
+		endpoint:   endpoint,
+		apiKey:     apiKey,
+		backoff:    backoff,
+		httpClient: &http.Client{Timeout: time.Minute},
+	}
 }
 
-func (c *AzureClient) GetVoices(speakers map[string]struct{}) map[string]string {
-	v := make(map[string]string)
-	var i int
-	for speaker := range speakers {
-		v[speaker] = Voices[i]
-		i++
-	}
-	return v
+func (a *Azure) Name() string {
+	return "azure"
 }
 
-// download audio file from azure text-to-speech api if it doesn't exist in cache dir.
-// we also store a sentenceAndDialogOnlyDir to create audio loops for which we want to exclude words and chars.
-func (c *AzureClient) Fetch(ctx context.Context, query, filename string, retryCount int) error {
-	filename = strings.ReplaceAll(filename, " ", "")
-	if c.cache.Get(filename) {
-		slog.Debug("fetch azure audio, query found in cache")
-		return nil
+func (a *Azure) Synthesize(ctx context.Context, r Request) ([]byte, error) {
+	if r.Format != MP3 {
+		return nil, unsupportedFormat(r.Format)
 	}
-	// time.Sleep(2000 * time.Millisecond)
-	if retryCount <= 0 {
-		slog.Error("download azure audio", "error", "exceeded retries", "query", query)
-		return nil
-	}
-	if contains(c.ignoreChars, query) {
-		return nil
-	}
-
-	if err := os.MkdirAll(c.AudioDir, os.ModePerm); err != nil {
+	ssml := SSML(r)
+	// quota errors, rate limits and server errors are retried
+	var audio []byte
+	err := a.backoff.Do(ctx, func() error {
+		var err error
+		audio, err = a.send(ctx, ssml)
+		if err != nil {
+			slog.Debug("azure text-to-speech", "text", r.Text, "err", err)
+		}
 		return err
-	}
-	lessonPath := filepath.Join(c.AudioDir, filename)
-
-	resp, err := c.fetch(ctx, query, maxRetries)
+	})
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("azure text-to-speech: %w", err)
 	}
-	defer resp.Body.Close()
+	return audio, nil
+}
 
-	out, err := os.Create(lessonPath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
+// StatusError is returned for responses with a status other than 200.
+type StatusError struct {
+	Code    int
+	Message string
+	// parsed from the Retry-After header
+	Wait time.Duration
+}
 
-	if _, err := io.Copy(out, resp.Body); err != nil {
-		return err
-	}
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Code, e.Message)
+}
 
-	slog.Debug("download audio", "path", lessonPath)
-	return nil
+func (e *StatusError) RetryAfter() time.Duration {
+	return e.Wait
 }
 
-func (c *AzureClient) fetch(ctx context.Context, query string, retryCount int) (*http.Response, error) {
-	if retryCount == -1 {
-		return nil, fmt.Errorf("excceded retries for query: %s", query)
-	}
-	if retryCount == maxRetries {
-		query = fmt.Sprintf(`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="https://www.w3.org/2001/mstts" xml:lang="zh-CN">%s</speak>`, query)
-	}
-	req, err := http.NewRequest("POST", c.endpoint, bytes.NewBuffer([]byte(query)))
+func (a *Azure) send(ctx context.Context, ssml string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", a.endpoint, bytes.NewBufferString(ssml))
 	if err != nil {
-		fmt.Printf("error creating request: %v", err)
-		fmt.Println("retry...")
-		return c.fetch(ctx, query, retryCount-1)
+		return nil, retry.Permanent(fmt.Errorf("create request: %w", err))
 	}
-
-	req.Header.Set("Ocp-Apim-Subscription-Key", c.apiKey)
+	req.Header.Set("Ocp-Apim-Subscription-Key", a.apiKey)
 	req.Header.Set("Content-Type", "application/ssml+xml")
 	req.Header.Set("X-Microsoft-OutputFormat", "audio-16khz-128kbitrate-mono-mp3")
-	req.Header.Set("User-Agent", "curl")
+	req.Header.Set("User-Agent", "zh-anki")
 
-	client := &http.Client{
-		Transport: &http2.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
-	resp, err := client.Do(req)
+	resp, err := a.httpClient.Do(req)
 	if err != nil {
-		fmt.Printf("error sending request to azure text-to-speech api: %v", err)
-		fmt.Println("retry...")
-		return c.fetch(ctx, query, retryCount-1)
+		if ctx.Err() != nil {
+			return nil, retry.Permanent(ctx.Err())
+		}
+		return nil, fmt.Errorf("send request: %w", err)
 	}
+	defer resp.Body.Close()
 
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
 	if resp.StatusCode != http.StatusOK {
-		buf := new(strings.Builder)
-		_, err = io.Copy(buf, resp.Body)
-		if err != nil {
-			fmt.Println(err)
+		statusErr := &StatusError{
+			Code:    resp.StatusCode,
+			Message: strings.TrimSpace(string(body)),
+			Wait:    retry.ParseRetryAfter(resp.Header.Get("Retry-After")),
 		}
-		s := buf.String()
-		if s == "Quota Exceeded" || resp.StatusCode == http.StatusTooManyRequests {
-			time.Sleep(5000 * time.Millisecond)
-			return c.fetch(ctx, query, retryCount-1)
+		if statusErr.Message == "" {
+			statusErr.Message = http.StatusText(resp.StatusCode)
 		}
-		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
-	}
-
-	return resp, nil
-}
-
-func (c *AzureClient) PrepareQueryWithRandomVoice(text string, addSplitAudio bool) string {
-	speaker := c.GetRandomVoice()
-	return c.PrepareQuery(text, speaker, addSplitAudio)
-}
-
-// if text contains whitespaces and addSplitAudio is true, text is added twice, once with all
-// whitespaces stipped off and once with whitespaces. azure api renders whitespaces as pauses in the audio.
-func (c *AzureClient) PrepareQuery(text, speaker string, addSplitAudio bool) string {
-	slog.Debug("prepare azure query", "voice", speaker, "text", text)
-	queryFmt := `<voice name="%s"><prosody rate="%s">%s</prosody></voice>`
-	query := fmt.Sprintf(queryFmt, speaker, rate, strings.ReplaceAll(text, " ", ""))
-	if addSplitAudio {
-		query += fmt.Sprintf(queryFmt, speaker, rate, text)
-	}
-	return query
-}
-
-func contains[T comparable](s []T, e T) bool {
-	for _, v := range s {
-		if v == e {
-			return true
+		if statusErr.Message == "Quota Exceeded" || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, statusErr
 		}
+		return nil, retry.Permanent(statusErr)
 	}
-	return false
+	return body, nil
 }
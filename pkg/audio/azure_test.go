@@ -0,0 +1,75 @@
+package audio
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/zh-anki/pkg/retry"
+)
+
+func TestAzureRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Quota Exceeded"))
+		default:
+			w.Write([]byte("mp3"))
+		}
+	}))
+	defer server.Close()
+
+	a := NewAzure(server.URL, "key")
+	a.backoff = retry.Backoff{Attempts: 3, Base: time.Millisecond, Max: time.Millisecond}
+	b, err := a.Synthesize(context.Background(), Request{Text: "你好", Voice: "v", Rate: 1, Format: MP3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || string(b) != "mp3" {
+		t.Fatalf("expected success on the third call, got %d calls and %q", calls, b)
+	}
+
+	// client errors are not retried
+	calls = 0
+	badRequest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer badRequest.Close()
+	a = NewAzure(badRequest.URL, "key")
+	a.backoff = retry.Backoff{Attempts: 3, Base: time.Millisecond, Max: time.Millisecond}
+	_, err = a.Synthesize(context.Background(), Request{Text: "你好", Format: MP3})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusBadRequest || calls != 1 {
+		t.Fatalf("expected a single bad request, got %v after %d calls", err, calls)
+	}
+}
+
+func TestAzureCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	a := NewAzure(server.URL, "key")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := a.Synthesize(ctx, Request{Text: "你好", Format: MP3})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("expected the retry after delay to be canceled")
+	}
+}
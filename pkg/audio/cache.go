@@ -1,49 +1,336 @@
 package audio
 
 import (
-	"io"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
-	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/fbngrm/zh-anki/pkg/media"
 	"golang.org/x/exp/slog"
 )
 
-type Cache struct {
-	SrcDir string
-	DstDir string
+const manifestFile = "manifest.json"
+
+// entries added since the manifest was written, one JSON object per line. Appending is
+// cheap, the journal is merged into the manifest by the next NewCache.
+const journalFile = "manifest.jsonl"
+
+// Entry describes how a cached audio file was produced.
+type Entry struct {
+	Text     string    `json:"text"`
+	Voice    string    `json:"voice"`
+	Rate     float64   `json:"rate"`
+	Provider string    `json:"provider"`
+	Format   Format    `json:"format"`
+	Split    bool      `json:"split,omitempty"` // text is read twice, see Client.SplitAudio
+	Filename string    `json:"filename"`        // in the anki media dir
+	Created  time.Time `json:"created"`
+	// see SSML
+	Hints       []Hint        `json:"hints,omitempty"`
+	WordBreak   time.Duration `json:"word_break,omitempty"`
+	ClauseBreak time.Duration `json:"clause_break,omitempty"`
+}
+
+// Key is a hash of everything that changes the audio, the filename is not part of it.
+// Hints and breaks are only added if set, so the keys of entries without them don't
+// change.
+func (e Entry) Key() string {
+	s := fmt.Sprintf("%s\x00%s\x00%g\x00%s\x00%s\x00%t",
+		e.Text, e.Voice, e.Rate, e.Provider, e.Format, e.Split)
+	for _, h := range e.Hints {
+		s += "\x00" + h.Text + "=" + h.Pinyin
+	}
+	if e.WordBreak > 0 || e.ClauseBreak > 0 {
+		s += fmt.Sprintf("\x00%s\x00%s", e.WordBreak, e.ClauseBreak)
+	}
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:16])
 }
 
-func (c *Cache) Get(filename string) bool {
-	src := path.Join(c.SrcDir, filename)
+type manifest struct {
+	Entries map[string]Entry `json:"entries"`
+}
 
-	if _, err := os.Stat(src); os.IsNotExist(err) {
-		return false
+// Cache stores audio files named by the key of their entry. The manifest maps keys to
+// the entries. Files of the old cache, named after the anki filename, are still found.
+type Cache struct {
+	Dir string
+
+	mu       sync.Mutex
+	manifest manifest
+	// keys of the entries by text, see Voice
+	byText map[string][]string
+}
+
+func NewCache(dir string) (*Cache, error) {
+	c := &Cache{
+		Dir:      dir,
+		manifest: manifest{Entries: make(map[string]Entry)},
+		byText:   make(map[string][]string),
+	}
+	b, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("read audio cache manifest: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &c.manifest); err != nil {
+			return nil, fmt.Errorf("parse audio cache manifest: %w", err)
+		}
+		if c.manifest.Entries == nil {
+			c.manifest.Entries = make(map[string]Entry)
+		}
 	}
+	replayed, err := c.replayJournal()
+	if err != nil {
+		return nil, err
+	}
+	for key, e := range c.manifest.Entries {
+		c.byText[e.Text] = append(c.byText[e.Text], key)
+	}
+	if replayed {
+		if err := c.writeManifest(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
 
-	srcFile, err := os.Open(src)
+// replayJournal adds the entries of the journal to the manifest. A partial last line,
+// e.g. of an interrupted run, is skipped.
+func (c *Cache) replayJournal() (bool, error) {
+	b, err := os.ReadFile(filepath.Join(c.Dir, journalFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
 	if err != nil {
-		slog.Error("open cached audio file", "err", err)
+		return false, fmt.Errorf("read audio cache journal: %w", err)
+	}
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			slog.Warn("skip invalid audio cache journal entry", "err", err)
+			continue
+		}
+		c.manifest.Entries[e.Key()] = e
+	}
+	return true, nil
+}
+
+// Get links the cached audio of e to dst.
+func (c *Cache) Get(e Entry, dst string) bool {
+	key := e.Key()
+	c.mu.Lock()
+	cached, ok := c.manifest.Entries[key]
+	c.mu.Unlock()
+	if !ok {
 		return false
 	}
-	defer srcFile.Close()
+	if err := link(c.path(key, cached.Format), dst); err != nil {
+		slog.Error("link cached audio", "key", key, "err", err)
+		return false
+	}
+	return true
+}
+
+// Voice returns the voice of the latest entry for the same text and settings, so a
+// text keeps its voice across runs.
+func (c *Cache) Voice(e Entry) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var latest *Entry
+	for _, key := range c.byText[e.Text] {
+		cached := c.manifest.Entries[key]
+		if cached.Provider != e.Provider || cached.Rate != e.Rate ||
+			cached.Format != e.Format || cached.Split != e.Split {
+			continue
+		}
+		if latest == nil || cached.Created.After(latest.Created) {
+			latest = &cached
+		}
+	}
+	if latest == nil {
+		return "", false
+	}
+	return latest.Voice, true
+}
 
-	if err := os.MkdirAll(c.DstDir, os.ModePerm); err != nil {
-		slog.Error("create tmp audio cache dir", "err", err)
+// GetLegacy links a file of the old cache, which is named after the anki filename. The
+// voice and rate of these files are unknown. Files named after the text are renamed
+// by MigrateLegacyNames, until then they are looked up by their old name.
+func (c *Cache) GetLegacy(filename, dst string) bool {
+	src := filepath.Join(c.Dir, filename)
+	if _, err := os.Stat(src); err != nil {
 		return false
 	}
+	return link(src, dst) == nil
+}
 
-	dstFile, err := os.Create(path.Join(c.DstDir, filename))
+// Put stores the audio and appends e to the journal.
+func (c *Cache) Put(e Entry, audio []byte) error {
+	if e.Created.IsZero() {
+		e.Created = time.Now().UTC()
+	}
+	key := e.Key()
+	if err := os.MkdirAll(c.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := media.WriteFile(c.path(key, e.Format), audio); err != nil {
+		return fmt.Errorf("write cached audio: %w", err)
+	}
+	line, err := json.Marshal(e)
 	if err != nil {
-		slog.Error("create tmp audio cache file", "err", err)
-		return false
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.manifest.Entries[key]; !ok {
+		c.byText[e.Text] = append(c.byText[e.Text], key)
 	}
-	defer dstFile.Close()
+	c.manifest.Entries[key] = e
+	f, err := os.OpenFile(filepath.Join(c.Dir, journalFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open audio cache journal: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write audio cache journal: %w", err)
+	}
+	return f.Close()
+}
+
+// writeManifest writes all entries to the manifest and removes the journal. The caller
+// holds the lock or owns the cache.
+func (c *Cache) writeManifest() error {
+	b, err := json.MarshalIndent(c.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := media.WriteFile(filepath.Join(c.Dir, manifestFile), b); err != nil {
+		return fmt.Errorf("write audio cache manifest: %w", err)
+	}
+	if err := os.Remove(filepath.Join(c.Dir, journalFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove audio cache journal: %w", err)
+	}
+	return nil
+}
 
-	_, err = io.Copy(dstFile, srcFile)
+// MigrateLegacyNames renames the files of the old cache, named after the text, and the
+// filenames in the manifest to the scheme of media.Filename. Returns the old names
+// mapped to the new ones. Nothing is changed in a dry run.
+func (c *Cache) MigrateLegacyNames(dry bool) (map[string]string, error) {
+	files, err := os.ReadDir(c.Dir)
 	if err != nil {
-		slog.Error("copy audio cache file", "err", err)
+		return nil, err
+	}
+	renamed := make(map[string]string)
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || filepath.Ext(name) != ".mp3" || isKey(strings.TrimSuffix(name, ".mp3")) {
+			continue
+		}
+		newName, ok := media.Rename(name)
+		if !ok {
+			continue
+		}
+		renamed[name] = newName
+		if dry {
+			continue
+		}
+		if err := os.Rename(filepath.Join(c.Dir, name), filepath.Join(c.Dir, newName)); err != nil {
+			return renamed, fmt.Errorf("rename cached audio %s: %w", name, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := false
+	for key, e := range c.manifest.Entries {
+		if newName, ok := media.Rename(e.Filename); ok {
+			renamed[e.Filename] = newName
+			e.Filename = newName
+			c.manifest.Entries[key] = e
+			changed = true
+		}
+	}
+	if !changed || dry {
+		return renamed, nil
+	}
+	return renamed, c.writeManifest()
+}
+
+// isKey reports whether name is the key of an entry, see Entry.Key.
+func isKey(name string) bool {
+	if len(name) != 32 {
 		return false
 	}
+	_, err := hex.DecodeString(name)
+	return err == nil
+}
 
-	return true
+func (c *Cache) path(key string, f Format) string {
+	return filepath.Join(c.Dir, key+"."+string(f))
+}
+
+// link skips files that are already present. dst is replaced and never truncated, it
+// may be a hard link to another cache file. Hard links fail across file systems, e.g.
+// for a cache in Dropbox, in this case the file is copied.
+func link(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil {
+		if os.SameFile(srcInfo, dstInfo) || sameContent(src, dst, srcInfo, dstInfo) {
+			return nil
+		}
+	}
+	dir := filepath.Dir(dst)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	if err := os.Link(src, tmp.Name()); err == nil {
+		if err := os.Rename(tmp.Name(), dst); err != nil {
+			os.Remove(tmp.Name())
+			return err
+		}
+		return nil
+	}
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return media.WriteFile(dst, b)
+}
+
+func sameContent(src, dst string, srcInfo, dstInfo os.FileInfo) bool {
+	if srcInfo.Size() != dstInfo.Size() {
+		return false
+	}
+	a, err := os.ReadFile(src)
+	if err != nil {
+		return false
+	}
+	b, err := os.ReadFile(dst)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(a, b)
 }
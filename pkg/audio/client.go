@@ -0,0 +1,217 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fbngrm/zh-anki/pkg/media"
+	"golang.org/x/exp/slog"
+)
+
+// Client writes the audio of a synthesizer to the audio dir, unless it is cached.
+type Client struct {
+	Synthesizer Synthesizer
+	Cache       *Cache
+	Voices      *Policy
+	AudioDir    string
+	IgnoreChars []string
+	// text is read twice, once with all whitespaces stripped off and once with a
+	// break between the words.
+	SplitAudio bool
+	// bounds the requests to the synthesizer, optional
+	Pool *Pool
+}
+
+func NewClient(s Synthesizer, cache *Cache, voices *Policy, audioDir string, ignoreChars []string) *Client {
+	return &Client{
+		Synthesizer: s,
+		Cache:       cache,
+		Voices:      voices,
+		AudioDir:    audioDir,
+		IgnoreChars: ignoreChars,
+	}
+}
+
+// Fetch synthesizes text for a card of kind and stores it as filename in the audio dir.
+// It returns the voice, which is empty for files of the old cache. Hints are the
+// pronunciation of polyphonic words in the text.
+//
+// The voice set for the kind is used if any. Otherwise text that has been cached keeps
+// its voice and files of the old cache are used as they are. New text gets the voice
+// of its hash.
+func (c *Client) Fetch(ctx context.Context, kind Kind, text, filename string, hints ...Hint) (string, error) {
+	if v, ok := c.Voices.Kind(kind); ok {
+		return v.Name, c.FetchWithVoice(ctx, kind, text, v.Name, filename, hints...)
+	}
+	if c.Cache != nil {
+		e := c.entry(kind, text, "", filename, hints)
+		if voice, ok := c.Cache.Voice(e); ok {
+			return voice, c.FetchWithVoice(ctx, kind, text, voice, filename, hints...)
+		}
+		for _, legacy := range legacyFilenames(text, e.Filename) {
+			if c.Cache.GetLegacy(legacy, filepath.Join(c.AudioDir, e.Filename)) {
+				slog.Debug("fetch audio, found in legacy cache", "filename", legacy)
+				return "", nil
+			}
+		}
+	}
+	voice := c.Voices.Text(strings.ReplaceAll(text, " ", "")).Name
+	return voice, c.FetchWithVoice(ctx, kind, text, voice, filename, hints...)
+}
+
+// legacyFilenames returns the names of text in the old cache: the filename, for files
+// renamed by Cache.MigrateLegacyNames, and the names after the text, with and without
+// whitespace, for files that are not migrated yet.
+func legacyFilenames(text, filename string) []string {
+	ext := filepath.Ext(filename)
+	names := []string{filename}
+	for _, name := range []string{strings.ReplaceAll(text, " ", "") + ext, text + ext} {
+		// text with a path separator was never a valid name
+		if name != ext && filepath.Base(name) == name && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// FetchSpeaker synthesizes a line of a dialogue with the voice of the speaker.
+func (c *Client) FetchSpeaker(ctx context.Context, speaker, text, filename string, hints ...Hint) (string, error) {
+	voice := c.Voices.Speaker(speaker).Name
+	return voice, c.FetchWithVoice(ctx, KindSentence, text, voice, filename, hints...)
+}
+
+func (c *Client) FetchWithVoice(ctx context.Context, kind Kind, text, voice, filename string, hints ...Hint) error {
+	if contains(c.IgnoreChars, text) {
+		return nil
+	}
+	e := c.entry(kind, text, voice, filename, hints)
+	path := filepath.Join(c.AudioDir, e.Filename)
+	// the same file is fetched once at a time, e.g. a line repeated in a dialogue. The
+	// same key means the same text, so it is covered by the filename.
+	unlock := fileLocks.lock(path)
+	defer unlock()
+	if c.Cache != nil && c.Cache.Get(e, path) {
+		slog.Debug("fetch audio, found in cache", "filename", e.Filename, "voice", voice)
+		return nil
+	}
+
+	requests := []Request{{
+		Text:        strings.Join(strings.Fields(text), ""),
+		ClauseBreak: e.ClauseBreak,
+	}}
+	if c.SplitAudio {
+		requests = append(requests, Request{
+			Text:        text,
+			WordBreak:   e.WordBreak,
+			ClauseBreak: e.ClauseBreak,
+		})
+	}
+	var audio []byte
+	synthesize := func(ctx context.Context) error {
+		for _, r := range requests {
+			r.Voice = voice
+			r.Rate = e.Rate
+			r.Format = e.Format
+			r.Hints = hints
+			// mp3 frames can be concatenated
+			b, err := c.Synthesizer.Synthesize(ctx, r)
+			if err != nil {
+				return fmt.Errorf("synthesize [%s]: %w", r.Text, err)
+			}
+			audio = append(audio, b...)
+		}
+		return nil
+	}
+	var err error
+	if c.Pool != nil {
+		err = c.Pool.Do(ctx, synthesize)
+	} else {
+		err = synthesize(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.AudioDir, os.ModePerm); err != nil {
+		return err
+	}
+	// the file may be a hard link into the cache, it is replaced instead of overwritten
+	if err := media.WriteFile(path, audio); err != nil {
+		return err
+	}
+	if c.Cache != nil {
+		if err := c.Cache.Put(e, audio); err != nil {
+			slog.Error("cache audio", "filename", e.Filename, "err", err)
+		}
+	}
+	slog.Debug("download audio", "path", path, "voice", voice)
+	return nil
+}
+
+func (c *Client) entry(kind Kind, text, voice, filename string, hints []Hint) Entry {
+	e := Entry{
+		Text:     text,
+		Voice:    voice,
+		Rate:     c.Voices.Rate(kind),
+		Provider: c.Synthesizer.Name(),
+		Format:   MP3,
+		Split:    c.SplitAudio,
+		Hints:    hints,
+		Filename: strings.ReplaceAll(filename, " ", ""),
+	}
+	e.WordBreak, e.ClauseBreak = c.Voices.Breaks()
+	if !c.SplitAudio {
+		e.WordBreak = 0
+	}
+	return e
+}
+
+// fileLocks are shared by all clients, words and sentences are written to the same dir.
+var fileLocks = keyedMutex{locks: make(map[string]*refMutex)}
+
+type refMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// keyedMutex locks by key, unused locks are removed.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refMutex
+}
+
+func (k *keyedMutex) lock(key string) func() {
+	k.mu.Lock()
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+
+	m.Lock()
+	return func() {
+		m.Unlock()
+		k.mu.Lock()
+		m.refs--
+		if m.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+func contains[T comparable](s []T, e T) bool {
+	for _, v := range s {
+		if v == e {
+			return true
+		}
+	}
+	return false
+}
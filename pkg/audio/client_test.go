@@ -0,0 +1,351 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/fbngrm/zh-anki/pkg/media"
+)
+
+func TestFakeSynthesize(t *testing.T) {
+	f := &Fake{}
+	b, err := f.Synthesize(context.Background(), Request{Text: "你好", Voice: "fake", Rate: 1, Format: MP3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) == 0 || len(b)%silentFrameSize != 0 {
+		t.Fatalf("expected whole frames, got %d bytes", len(b))
+	}
+	for i := 0; i < len(b); i += silentFrameSize {
+		if !bytes.HasPrefix(b[i:], silentFrameHeader) {
+			t.Fatalf("frame at %d has no mp3 header", i)
+		}
+	}
+	again, _ := f.Synthesize(context.Background(), Request{Text: "你好", Voice: "fake", Rate: 1, Format: MP3})
+	if !bytes.Equal(b, again) {
+		t.Fatal("expected deterministic audio")
+	}
+	slow, _ := f.Synthesize(context.Background(), Request{Text: "你好", Voice: "fake", Rate: 0.5, Format: MP3})
+	if len(slow) <= len(b) {
+		t.Fatalf("expected slower audio to be longer, got %d <= %d", len(slow), len(b))
+	}
+	if _, err := f.Synthesize(context.Background(), Request{Text: "你好", Format: "wav"}); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+}
+
+type recorder struct {
+	Fake
+	requests []Request
+}
+
+func (r *recorder) Synthesize(ctx context.Context, req Request) ([]byte, error) {
+	r.requests = append(r.requests, req)
+	return r.Fake.Synthesize(ctx, req)
+}
+
+func testPolicy(t *testing.T) *Policy {
+	p, err := NewPolicy(VoiceConfig{Voices: []Voice{
+		{Name: "f1", Gender: "female", Provider: "fake"},
+		{Name: "m1", Gender: "male", Provider: "fake"},
+	}, Rates: map[Kind]float64{KindSentence: 0.7}}, "fake", kinds...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestClientFetch(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := t.TempDir()
+	// file of the old cache, named after the anki filename
+	if err := os.WriteFile(filepath.Join(cacheDir, "我.mp3"), []byte("legacy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	synth := &recorder{}
+	c := NewClient(synth, cache, testPolicy(t), dir, []string{"。"})
+	c.SplitAudio = true
+
+	voice, err := c.Fetch(context.Background(), KindSentence, "我 喜欢 你", "我 喜欢 你.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if voice != c.Voices.Text("我喜欢你").Name {
+		t.Fatalf("expected the voice of the text hash, got %q", voice)
+	}
+	if len(synth.requests) != 2 || synth.requests[0].Text != "我喜欢你" || synth.requests[1].Text != "我 喜欢 你" {
+		t.Fatalf("unexpected requests: %+v", synth.requests)
+	}
+	if synth.requests[0].Rate != 0.7 || synth.requests[0].Voice != voice {
+		t.Fatalf("unexpected request: %+v", synth.requests[0])
+	}
+	fetched, err := os.ReadFile(filepath.Join(dir, "我喜欢你.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// legacy and ignored texts are not synthesized
+	if _, err := c.Fetch(context.Background(), KindWord, "我", "我.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Fetch(context.Background(), KindWord, "。", "。.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(synth.requests) != 2 {
+		t.Fatalf("expected no more requests, got %d", len(synth.requests))
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, "我.mp3")); string(b) != "legacy" {
+		t.Fatalf("expected legacy audio, got %q", b)
+	}
+	// legacy files that are not migrated yet are found by the text
+	if err := os.WriteFile(filepath.Join(cacheDir, "你好.mp3"), []byte("unmigrated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	filename := media.Filename("你 好", ".mp3")
+	if _, err := c.Fetch(context.Background(), KindWord, "你 好", filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(synth.requests) != 2 {
+		t.Fatalf("expected no more requests, got %d", len(synth.requests))
+	}
+	if b, _ := os.ReadFile(filepath.Join(dir, filename)); string(b) != "unmigrated" {
+		t.Fatalf("expected legacy audio, got %q", b)
+	}
+
+	// the manifest is read by the next run, the audio is linked into a new dir
+	cache, err = NewCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Entry{Text: "我 喜欢 你", Voice: voice, Rate: 0.7, Provider: "fake", Format: MP3, Split: true}
+	if cached, ok := cache.Voice(e); !ok || cached != voice {
+		t.Fatalf("expected cached voice %q, got %q", voice, cached)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, e.Key()+".mp3")); err != nil {
+		t.Fatal(err)
+	}
+	next := t.TempDir()
+	c = NewClient(synth, cache, testPolicy(t), next, nil)
+	c.SplitAudio = true
+	if _, err := c.Fetch(context.Background(), KindSentence, "我 喜欢 你", "我 喜欢 你.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(synth.requests) != 2 {
+		t.Fatalf("expected cached audio, got %d requests", len(synth.requests))
+	}
+	if b, _ := os.ReadFile(filepath.Join(next, "我喜欢你.mp3")); !bytes.Equal(b, fetched) {
+		t.Fatal("expected the cached audio")
+	}
+
+	// a different rate is a different entry
+	if _, err := c.Fetch(context.Background(), KindWord, "我 喜欢 你", "我 喜欢 你.mp3"); err != nil {
+		t.Fatal(err)
+	}
+	if len(synth.requests) != 4 {
+		t.Fatalf("expected new requests, got %d", len(synth.requests))
+	}
+	if b, _ := os.ReadFile(filepath.Join(cacheDir, e.Key()+".mp3")); !bytes.Equal(b, fetched) {
+		t.Fatal("expected the cached audio to be unchanged")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	cfg := VoiceConfig{
+		Voices:   DefaultVoiceConfig.Voices,
+		Kinds:    map[Kind]string{KindWord: "cmn-TW-Wavenet-A", KindSentence: "zh-CN-XiaochenNeural"},
+		Speakers: map[string]string{"老师": "zh-CN-YunjianNeural"},
+	}
+	p, err := NewPolicy(cfg, "azure", KindSentence, KindCloze)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// kinds read by another policy are ignored
+	if _, ok := p.Kind(KindWord); ok {
+		t.Fatal("expected no azure voice for words")
+	}
+	if v, ok := p.Kind(KindSentence); !ok || v.Name != "zh-CN-XiaochenNeural" {
+		t.Fatalf("expected the voice of the kind, got %+v", v)
+	}
+	if p.Text("我喜欢你") != p.Text("我喜欢你") {
+		t.Fatal("expected the same voice for the same text")
+	}
+	if v := p.Speaker("老师"); v.Name != "zh-CN-YunjianNeural" {
+		t.Fatalf("expected the configured voice, got %s", v.Name)
+	}
+	a, b := p.Speaker("A"), p.Speaker("B")
+	if a.Name == b.Name || a.Gender == b.Gender || a.Name == "zh-CN-YunjianNeural" {
+		t.Fatalf("expected different voices, got %+v and %+v", a, b)
+	}
+	if p.Speaker("A") != a {
+		t.Fatal("expected the same voice for a speaker")
+	}
+
+	gcp, err := NewPolicy(cfg, "gcp", KindWord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := gcp.Kind(KindWord); !ok || v.Region != "TW" {
+		t.Fatalf("expected the voice of the kind, got %+v", v)
+	}
+}
+
+func TestPolicyOtherProvider(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cfg      VoiceConfig
+		expected string
+	}{
+		"kind": {
+			cfg:      VoiceConfig{Voices: DefaultVoiceConfig.Voices, Kinds: map[Kind]string{KindCloze: "cmn-CN-Wavenet-A"}},
+			expected: "voice cmn-CN-Wavenet-A of kind cloze is a gcp voice",
+		},
+		"speaker": {
+			cfg:      VoiceConfig{Voices: DefaultVoiceConfig.Voices, Speakers: map[string]string{"A": "cmn-CN-Wavenet-C"}},
+			expected: "voice cmn-CN-Wavenet-C of speaker A is a gcp voice",
+		},
+	} {
+		_, err := NewPolicy(tc.cfg, "azure", KindSentence, KindCloze)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected error %q, got %v", name, tc.expected, err)
+		}
+	}
+}
+
+func TestVoiceConfigValidate(t *testing.T) {
+	for name, cfg := range map[string]VoiceConfig{
+		"gender":   {Voices: []Voice{{Name: "a", Gender: "x", Provider: "azure"}}},
+		"provider": {Voices: []Voice{{Name: "a", Gender: "male"}}},
+		"duplicate": {Voices: []Voice{
+			{Name: "a", Gender: "male", Provider: "azure"},
+			{Name: "a", Gender: "male", Provider: "azure"},
+		}},
+		"kind":    {Voices: DefaultVoiceConfig.Voices, Kinds: map[Kind]string{"audio": "zh-CN-YunjianNeural"}},
+		"voice":   {Voices: DefaultVoiceConfig.Voices, Kinds: map[Kind]string{KindWord: "unknown"}},
+		"speaker": {Voices: DefaultVoiceConfig.Voices, Speakers: map[string]string{"A": "unknown"}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if err := DefaultVoiceConfig.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateLegacyNames(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "我喜欢你.mp3"), []byte("legacy"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := Entry{Text: "你好", Voice: "f1", Rate: 1, Provider: "fake", Format: MP3, Filename: "你好.mp3"}
+	if err := cache.Put(e, []byte("audio")); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, err := cache.MigrateLegacyNames(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(renamed) != 2 {
+		t.Fatalf("expected the legacy file and the manifest entry, got %v", renamed)
+	}
+	newName := media.Filename("我 喜欢 你", ".mp3")
+	if renamed["我喜欢你.mp3"] != newName {
+		t.Fatalf("unexpected names %v", renamed)
+	}
+	// legacy files are found by the new name, files named by key are kept
+	if !cache.GetLegacy(newName, filepath.Join(t.TempDir(), newName)) {
+		t.Fatal("expected the renamed legacy file")
+	}
+	if !cache.Get(e, filepath.Join(t.TempDir(), "a.mp3")) {
+		t.Fatal("expected the cached audio")
+	}
+	cache, err = NewCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cache.manifest.Entries[e.Key()].Filename; got != media.Filename("你好", ".mp3") {
+		t.Fatalf("expected the new filename in the manifest, got %s", got)
+	}
+
+	renamed, err = cache.MigrateLegacyNames(false)
+	if err != nil || len(renamed) != 0 {
+		t.Fatalf("expected nothing to migrate, got %v %v", renamed, err)
+	}
+}
+
+// voiced returns the voice and the text, so audio of the wrong voice is detected
+type voiced struct {
+	Fake
+}
+
+func (*voiced) Synthesize(ctx context.Context, r Request) ([]byte, error) {
+	return []byte(r.Voice + ":" + r.Text), nil
+}
+
+func TestClientFetchConcurrent(t *testing.T) {
+	cacheDir := t.TempDir()
+	cache, err := NewCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c := NewClient(&voiced{}, cache, testPolicy(t), dir, nil)
+
+	// a line read by two speakers, fetched twice so the second round hits the cache
+	for round := 0; round < 2; round++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(voice string) {
+				defer wg.Done()
+				if err := c.FetchWithVoice(context.Background(), KindSentence, "你好", voice, "你好.mp3"); err != nil {
+					t.Error(err)
+				}
+			}([]string{"f1", "m1"}[i%2])
+		}
+		wg.Wait()
+	}
+
+	for _, voice := range []string{"f1", "m1"} {
+		e := c.entry(KindSentence, "你好", voice, "你好.mp3", nil)
+		b, err := os.ReadFile(filepath.Join(cacheDir, e.Key()+".mp3"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != voice+":你好" {
+			t.Fatalf("expected the audio of %s in the cache, got %q", voice, b)
+		}
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "你好.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "f1:你好" && string(b) != "m1:你好" {
+		t.Fatalf("unexpected audio %q", b)
+	}
+
+	// the journal is merged into the manifest by the next run
+	cache, err = NewCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cache.manifest.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(cache.manifest.Entries))
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, journalFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected the journal to be merged, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package audio
+
+import (
+	"context"
+	"unicode/utf8"
+)
+
+// silent MPEG-1 layer III frames, 128kbit/s, 48kHz, mono. A frame holds 1152 samples,
+// which is 24ms of audio. The side info is all zeros, so decoders play silence.
+var silentFrameHeader = []byte{0xFF, 0xFB, 0x94, 0xC0}
+
+const silentFrameSize = 384 // 144 * 128000 / 48000
+const frameDuration = 24    // ms
+
+// spoken duration of a single hanzi at the normal rate
+const fakeRuneDuration = 300 // ms
+
+// Fake synthesizes silence for offline runs and tests. The duration depends on the
+// length of the text and the rate, so the same request always yields the same bytes.
+// Any voice is accepted.
+type Fake struct{}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Synthesize(ctx context.Context, r Request) ([]byte, error) {
+	if r.Format != MP3 {
+		return nil, unsupportedFormat(r.Format)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rate := r.Rate
+	if rate <= 0 {
+		rate = DefaultRate
+	}
+	duration := float64(utf8.RuneCountInString(r.Text)*fakeRuneDuration) / rate
+	return silence(int(duration) / frameDuration), nil
+}
+
+func silence(frames int) []byte {
+	if frames < 1 {
+		frames = 1
+	}
+	b := make([]byte, frames*silentFrameSize)
+	for i := 0; i < frames; i++ {
+		copy(b[i*silentFrameSize:], silentFrameHeader)
+	}
+	return b
+}
@@ -2,109 +2,116 @@ package audio
 
 import (
 	"context"
-	"io/ioutil"
-	"math/rand"
-	"os"
-	"path/filepath"
+	"fmt"
+	"strings"
 	"time"
 
 	texttospeech "cloud.google.com/go/texttospeech/apiv1"
 	"cloud.google.com/go/texttospeech/apiv1/texttospeechpb"
-	"golang.org/x/exp/slog"
+	"github.com/fbngrm/zh-anki/pkg/retry"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-type GCPClient struct {
-	Cache       *Cache
-	IgnoreChars []string
-	AudioDir    string
+// GCP synthesizes speech with the google text-to-speech api. Credentials are read
+// from the environment, see GOOGLE_APPLICATION_CREDENTIALS. The client is shared by
+// all requests, call Close when done.
+type GCP struct {
+	client  *texttospeech.Client
+	backoff retry.Backoff
 }
 
-// we support 4 different voices only
-var voices = []*texttospeechpb.VoiceSelectionParams{
-	{
-		LanguageCode: "cmn-CN",
-		Name:         "cmn-CN-Wavenet-C",
-		SsmlGender:   texttospeechpb.SsmlVoiceGender_MALE,
-	},
-	{
-		LanguageCode: "cmn-CN",
-		Name:         "cmn-CN-Wavenet-A",
-		SsmlGender:   texttospeechpb.SsmlVoiceGender_FEMALE,
-	},
-	{
-		LanguageCode: "cmn-CN",
-		Name:         "cmn-TW-Wavenet-C",
-		SsmlGender:   texttospeechpb.SsmlVoiceGender_MALE,
-	},
-	{
-		LanguageCode: "cmn-CN",
-		Name:         "cmn-TW-Wavenet-A",
-		SsmlGender:   texttospeechpb.SsmlVoiceGender_FEMALE,
-	},
-}
-
-func (g *GCPClient) GetVoices(
-	speakers map[string]struct{},
-) map[string]*texttospeechpb.VoiceSelectionParams {
-	v := make(map[string]*texttospeechpb.VoiceSelectionParams)
-	var i int
-	for speaker := range speakers {
-		v[speaker] = voices[i]
-		i++
-	}
-	return v
-}
-
-// download audio file from google text-to-speech api if it doesn't exist in cache dir.
-// we also store a sentenceAndDialogOnlyDir to create audio loops for which we want to exclude words and chars.
-func (g *GCPClient) Fetch(ctx context.Context, query, filename string) error {
-	if g.Cache.Get(filename) {
-		return nil
-	}
-
-	lessonPath := filepath.Join(g.AudioDir, filename)
-	resp, err := fetch(ctx, query, nil)
+func NewGCP(ctx context.Context) (*GCP, error) {
+	client, err := texttospeech.NewClient(ctx)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("create gcp text-to-speech client: %w", err)
 	}
+	return &GCP{
+		client:  client,
+		backoff: backoff,
+	}, nil
+}
 
-	// the resp's AudioContent is binary.
-	err = ioutil.WriteFile(lessonPath, resp.AudioContent, os.ModePerm)
-	if err != nil {
-		return err
-	}
-	slog.Debug("download GCP audio", "path", lessonPath)
-	return nil
+func (g *GCP) Name() string {
+	return "gcp"
 }
 
-// uses a random voice if param voice is nil
-func fetch(ctx context.Context, query string, voice *texttospeechpb.VoiceSelectionParams) (*texttospeechpb.SynthesizeSpeechResponse, error) {
-	time.Sleep(100 * time.Millisecond)
-	client, err := texttospeech.NewClient(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer client.Close()
+func (g *GCP) Close() error {
+	return g.client.Close()
+}
 
-	if voice == nil {
-		rand.Seed(time.Now().UnixNano()) // initialize global pseudo random generator
-		voice = voices[rand.Intn(len(voices))]
+func (g *GCP) Synthesize(ctx context.Context, r Request) ([]byte, error) {
+	if r.Format != MP3 {
+		return nil, unsupportedFormat(r.Format)
 	}
-	// Perform the text-to-speech request on the text input with the selected
-	// voice parameters and audio file type.
 	req := texttospeechpb.SynthesizeSpeechRequest{
-		// Set the text input to be synthesized.
 		Input: &texttospeechpb.SynthesisInput{
-			InputSource: &texttospeechpb.SynthesisInput_Text{Text: query},
+			InputSource: &texttospeechpb.SynthesisInput_Text{Text: r.Text},
 		},
-		// Build the voice request, select the language code ("en-US") and the SSML
-		// voice gender ("neutral").
-		Voice: voice,
-		// Select the type of audio file you want returned.
+		Voice: gcpVoice(r.Voice),
 		AudioConfig: &texttospeechpb.AudioConfig{
 			AudioEncoding: texttospeechpb.AudioEncoding_MP3,
-			SpeakingRate:  1,
+			SpeakingRate:  r.Rate,
 		},
 	}
-	return client.SynthesizeSpeech(ctx, &req)
+	var audio []byte
+	err := g.backoff.Do(ctx, func() error {
+		resp, err := g.client.SynthesizeSpeech(ctx, &req)
+		if err != nil {
+			return gcpError(err)
+		}
+		// the resp's AudioContent is binary.
+		audio = resp.AudioContent
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("gcp text-to-speech: %w", err)
+	}
+	return audio, nil
+}
+
+// gcpRetryable is a quota error or an unavailable service, with the delay sent by
+// the server, if any.
+type gcpRetryable struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *gcpRetryable) Error() string {
+	return e.err.Error()
+}
+
+func (e *gcpRetryable) Unwrap() error {
+	return e.err
+}
+
+func (e *gcpRetryable) RetryAfter() time.Duration {
+	return e.wait
+}
+
+func gcpError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok || (s.Code() != codes.ResourceExhausted && s.Code() != codes.Unavailable) {
+		return retry.Permanent(err)
+	}
+	retryable := &gcpRetryable{err: err}
+	for _, d := range s.Details() {
+		if info, ok := d.(*errdetails.RetryInfo); ok {
+			retryable.wait = info.GetRetryDelay().AsDuration()
+		}
+	}
+	return retryable
+}
+
+// the language code is the prefix of the voice name, e.g. cmn-CN.
+func gcpVoice(name string) *texttospeechpb.VoiceSelectionParams {
+	languageCode := "cmn-CN"
+	if parts := strings.SplitN(name, "-", 3); len(parts) == 3 {
+		languageCode = parts[0] + "-" + parts[1]
+	}
+	return &texttospeechpb.VoiceSelectionParams{
+		LanguageCode: languageCode,
+		Name:         name,
+	}
 }
@@ -0,0 +1,43 @@
+package audio
+
+import "context"
+
+// Pool bounds the number of audio jobs that run at the same time. It is shared by the
+// clients of all processors, so the providers see at most size parallel requests. Jobs
+// are canceled once the context of the pool is done, e.g. on interrupt.
+type Pool struct {
+	ctx context.Context
+	sem chan struct{}
+}
+
+func NewPool(ctx context.Context, size int) *Pool {
+	return &Pool{
+		ctx: ctx,
+		sem: make(chan struct{}, max(size, 1)),
+	}
+}
+
+// Do waits for a free slot and calls f. The context passed to f is done if either ctx
+// or the context of the pool is done.
+func (p *Pool) Do(ctx context.Context, f func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.sem }()
+	// a slot may be free and the context done at the same time, the cancellation by
+	// the pool context runs in its own goroutine
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := p.ctx.Err(); err != nil {
+		return err
+	}
+	return f(ctx)
+}
@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fbngrm/zh-anki/pkg/pinyin"
+)
+
+// Hint is the pronunciation of a word in the text, e.g. 银行 yínháng. It is used for
+// words with polyphonic characters, which TTS often gets wrong.
+type Hint struct {
+	Text   string `json:"text"`
+	Pinyin string `json:"pinyin"`
+}
+
+// a clause break follows these, except at the end of the text
+const clausePunctuation = "，,。.！!？?；;：:、"
+
+// SSML builds the speak document of a request. Whitespaces separate words, they are
+// rendered as breaks of r.WordBreak. Hints are rendered as sapi phonemes.
+func SSML(r Request) string {
+	var sb strings.Builder
+	sb.WriteString(`<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xmlns:mstts="https://www.w3.org/2001/mstts" xml:lang="zh-CN">`)
+	fmt.Fprintf(&sb, `<voice name="%s"><prosody rate="%s">`, escape(r.Voice), strconv.FormatFloat(r.Rate, 'f', -1, 64))
+
+	phonemes := sapiHints(r.Hints)
+	text := []rune(strings.TrimSpace(r.Text))
+	for i := 0; i < len(text); {
+		if text[i] == ' ' {
+			for i < len(text) && text[i] == ' ' {
+				i++
+			}
+			// segmented text has whitespaces before punctuation too
+			if r.WordBreak > 0 && !unicode.IsPunct(text[i]) {
+				writeBreak(&sb, r.WordBreak)
+			}
+			continue
+		}
+		if h, ok := matchHint(text[i:], phonemes); ok {
+			fmt.Fprintf(&sb, `<phoneme alphabet="sapi" ph="%s">%s</phoneme>`, escape(h.Pinyin), escape(h.Text))
+			i += len([]rune(h.Text))
+			continue
+		}
+		sb.WriteString(escape(string(text[i])))
+		if strings.ContainsRune(clausePunctuation, text[i]) && i < len(text)-1 && r.ClauseBreak > 0 {
+			writeBreak(&sb, r.ClauseBreak)
+			// the break replaces the pause between words
+			for i+1 < len(text) && text[i+1] == ' ' {
+				i++
+			}
+		}
+		i++
+	}
+
+	sb.WriteString(`</prosody></voice></speak>`)
+	return sb.String()
+}
+
+func writeBreak(sb *strings.Builder, d time.Duration) {
+	fmt.Fprintf(sb, `<break time="%dms"/>`, d.Milliseconds())
+}
+
+func escape(s string) string {
+	var sb strings.Builder
+	// writing to a strings.Builder does not fail
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+// sapiHints converts the pinyin of the hints to sapi phonemes, e.g. yin 2 hang 2, and
+// drops hints with a syllable count that does not match the text. Longer hints come
+// first, so they match before the words they contain.
+func sapiHints(hints []Hint) []Hint {
+	var result []Hint
+	for _, h := range hints {
+		syllables, ok := pinyin.ParseSyllables(h.Pinyin)
+		if !ok || h.Text == "" || len(syllables) != len([]rune(h.Text)) {
+			continue
+		}
+		phones := make([]string, len(syllables))
+		for i, s := range syllables {
+			phones[i] = strings.ReplaceAll(s.Base, "ü", "v") + " " + strconv.Itoa(s.Tone)
+		}
+		result = append(result, Hint{Text: h.Text, Pinyin: strings.Join(phones, " ")})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return len([]rune(result[i].Text)) > len([]rune(result[j].Text))
+	})
+	return result
+}
+
+func matchHint(text []rune, hints []Hint) (Hint, bool) {
+	for _, h := range hints {
+		if strings.HasPrefix(string(text), h.Text) {
+			return h, true
+		}
+	}
+	return Hint{}, false
+}
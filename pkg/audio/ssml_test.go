@@ -0,0 +1,48 @@
+package audio
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSML(t *testing.T) {
+	r := Request{
+		Text:        "我 去 银行 ， 你 呢 <&> ？",
+		Voice:       "zh-CN-XiaoxiaoNeural",
+		Rate:        0.7,
+		Hints:       []Hint{{Text: "行", Pinyin: "xíng"}, {Text: "银行", Pinyin: "yínháng"}, {Text: "呢", Pinyin: "nǐne"}},
+		WordBreak:   300 * time.Millisecond,
+		ClauseBreak: 500 * time.Millisecond,
+	}
+	got := SSML(r)
+	for _, want := range []string{
+		`<voice name="zh-CN-XiaoxiaoNeural"><prosody rate="0.7">`,
+		`我<break time="300ms"/>去<break time="300ms"/><phoneme alphabet="sapi" ph="yin 2 hang 2">银行</phoneme>`,
+		// the clause break replaces the word break
+		`银行</phoneme>，<break time="500ms"/>你`,
+		`&lt;&amp;&gt;`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %s in %s", want, got)
+		}
+	}
+	// hints with the wrong number of syllables are dropped
+	if strings.Count(got, "<phoneme") != 1 {
+		t.Errorf("expected a single phoneme in %s", got)
+	}
+	// no break at the end of the text
+	if !strings.HasSuffix(got, `？</prosody></voice></speak>`) {
+		t.Errorf("unexpected end of %s", got)
+	}
+	if err := xml.Unmarshal([]byte(got), new(struct{})); err != nil {
+		t.Errorf("invalid xml: %v", err)
+	}
+
+	r.Text = "绿色"
+	r.Hints = []Hint{{Text: "绿色", Pinyin: "lǜsè"}}
+	if got := SSML(r); !strings.Contains(got, `ph="lv 4 se 4"`) {
+		t.Errorf("expected v for ü in %s", got)
+	}
+}
@@ -0,0 +1,37 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type Format string
+
+// MP3 is the only format anki needs, providers return mono mp3 at their default bitrate.
+const MP3 Format = "mp3"
+
+// DefaultRate is the normal speaking rate, see VoiceConfig for the rates per kind.
+const DefaultRate = 1.0
+
+type Request struct {
+	Text   string // whitespaces separate words
+	Voice  string
+	Rate   float64 // 1 is the normal speaking rate
+	Format Format
+	// used by providers that support SSML, see SSML
+	Hints       []Hint
+	WordBreak   time.Duration // 0 reads the words without pauses
+	ClauseBreak time.Duration
+}
+
+// Synthesizer converts text to speech, e.g. Azure, GCP or the offline Fake.
+type Synthesizer interface {
+	Synthesize(ctx context.Context, r Request) ([]byte, error)
+	// part of the cache key, e.g. azure
+	Name() string
+}
+
+func unsupportedFormat(f Format) error {
+	return fmt.Errorf("unsupported audio format: %s", f)
+}
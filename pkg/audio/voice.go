@@ -0,0 +1,265 @@
+package audio
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type Voice struct {
+	Name     string `yaml:"name"`
+	Gender   string `yaml:"gender"` // female or male
+	Region   string `yaml:"region"` // e.g. CN or TW
+	Provider string `yaml:"provider"`
+}
+
+// Kind of the card the audio is for, voices can be set per kind.
+type Kind string
+
+const (
+	KindWord     Kind = "word"
+	KindSentence Kind = "sentence"
+	KindCloze    Kind = "cloze"
+	KindGrammar  Kind = "grammar"
+	KindExample  Kind = "example" // example sentences of words and grammar
+)
+
+var kinds = []Kind{KindWord, KindSentence, KindCloze, KindGrammar, KindExample}
+
+// VoiceConfig is the voice catalog and the voices set per card kind and per dialogue
+// speaker. Kinds and speakers without a voice get one by the hash of the text.
+type VoiceConfig struct {
+	Voices   []Voice           `yaml:"voices"`
+	Kinds    map[Kind]string   `yaml:"kinds"`
+	Speakers map[string]string `yaml:"speakers"`
+	// speaking rate per kind, 1 is normal
+	Rates map[Kind]float64 `yaml:"rates"`
+	// pause between the words of split audio and after clauses, e.g. 300ms
+	WordBreak   time.Duration `yaml:"word_break"`
+	ClauseBreak time.Duration `yaml:"clause_break"`
+}
+
+var DefaultVoiceConfig = VoiceConfig{
+	Voices: []Voice{
+		{Name: "zh-CN-XiaoxiaoNeural", Gender: "female", Region: "CN", Provider: "azure"},
+		{Name: "zh-CN-YunjianNeural", Gender: "male", Region: "CN", Provider: "azure"},
+		{Name: "zh-CN-XiaochenNeural", Gender: "female", Region: "CN", Provider: "azure"},
+		// zh-CN-YinyangNeural is broken
+		{Name: "zh-CN-YunyiMultilingualNeural", Gender: "male", Region: "CN", Provider: "azure"},
+		{Name: "cmn-CN-Wavenet-C", Gender: "male", Region: "CN", Provider: "gcp"},
+		{Name: "cmn-CN-Wavenet-A", Gender: "female", Region: "CN", Provider: "gcp"},
+		{Name: "cmn-TW-Wavenet-C", Gender: "male", Region: "TW", Provider: "gcp"},
+		{Name: "cmn-TW-Wavenet-A", Gender: "female", Region: "TW", Provider: "gcp"},
+	},
+	// sentences are read slower than words
+	Rates: map[Kind]float64{
+		KindWord:     1,
+		KindSentence: 0.7,
+		KindCloze:    0.7,
+		KindGrammar:  0.7,
+		KindExample:  0.7,
+	},
+	WordBreak:   300 * time.Millisecond,
+	ClauseBreak: 500 * time.Millisecond,
+}
+
+// LoadVoiceConfig reads a yaml file, the default config is used if path is empty.
+// Missing voices, rates and breaks are taken from the default config.
+func LoadVoiceConfig(path string) (VoiceConfig, error) {
+	if path == "" {
+		return DefaultVoiceConfig, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return VoiceConfig{}, fmt.Errorf("read voice config: %w", err)
+	}
+	var cfg VoiceConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return VoiceConfig{}, fmt.Errorf("parse voice config %s: %w", path, err)
+	}
+	if len(cfg.Voices) == 0 {
+		cfg.Voices = DefaultVoiceConfig.Voices
+	}
+	if cfg.Rates == nil {
+		cfg.Rates = make(map[Kind]float64)
+	}
+	for kind, rate := range DefaultVoiceConfig.Rates {
+		if _, ok := cfg.Rates[kind]; !ok {
+			cfg.Rates[kind] = rate
+		}
+	}
+	if cfg.WordBreak == 0 {
+		cfg.WordBreak = DefaultVoiceConfig.WordBreak
+	}
+	if cfg.ClauseBreak == 0 {
+		cfg.ClauseBreak = DefaultVoiceConfig.ClauseBreak
+	}
+	if err := cfg.Validate(); err != nil {
+		return VoiceConfig{}, fmt.Errorf("voice config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c VoiceConfig) Validate() error {
+	names := make(map[string]struct{}, len(c.Voices))
+	for i, v := range c.Voices {
+		if v.Name == "" {
+			return fmt.Errorf("voices[%d]: missing name", i)
+		}
+		if _, ok := names[v.Name]; ok {
+			return fmt.Errorf("voices[%d]: duplicate voice %s", i, v.Name)
+		}
+		names[v.Name] = struct{}{}
+		if v.Gender != "female" && v.Gender != "male" {
+			return fmt.Errorf("voice %s: gender must be female or male, got %q", v.Name, v.Gender)
+		}
+		if v.Provider == "" {
+			return fmt.Errorf("voice %s: missing provider", v.Name)
+		}
+	}
+	for kind, name := range c.Kinds {
+		if !slices.Contains(kinds, kind) {
+			return fmt.Errorf("kinds: unknown kind %s", kind)
+		}
+		if _, ok := names[name]; !ok {
+			return fmt.Errorf("kinds: voice %s of kind %s is not in the catalog", name, kind)
+		}
+	}
+	for speaker, name := range c.Speakers {
+		if _, ok := names[name]; !ok {
+			return fmt.Errorf("speakers: voice %s of speaker %s is not in the catalog", name, speaker)
+		}
+	}
+	// supported by azure and gcp
+	for kind, rate := range c.Rates {
+		if !slices.Contains(kinds, kind) {
+			return fmt.Errorf("rates: unknown kind %s", kind)
+		}
+		if rate < 0.5 || rate > 2 {
+			return fmt.Errorf("rates: rate of kind %s must be between 0.5 and 2, got %g", kind, rate)
+		}
+	}
+	if c.WordBreak < 0 || c.WordBreak > maxBreak || c.ClauseBreak < 0 || c.ClauseBreak > maxBreak {
+		return fmt.Errorf("breaks must be between 0 and %s", maxBreak)
+	}
+	return nil
+}
+
+// the longest break azure supports
+const maxBreak = 5 * time.Second
+
+// Policy picks the voices of a single provider.
+type Policy struct {
+	voices      []Voice
+	kinds       map[Kind]Voice
+	rates       map[Kind]float64
+	wordBreak   time.Duration
+	clauseBreak time.Duration
+
+	mu         sync.Mutex
+	speakers   map[string]Voice
+	lastGender string // of the last assigned speaker
+}
+
+// NewPolicy keeps the voices of provider for the audio of kinds, dialogue speakers
+// are read with the voices of KindSentence. Kinds and speakers set to a voice of
+// another provider are an error, other kinds are read by another policy.
+func NewPolicy(cfg VoiceConfig, provider string, kinds ...Kind) (*Policy, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Policy{
+		kinds:       make(map[Kind]Voice),
+		rates:       cfg.Rates,
+		wordBreak:   cfg.WordBreak,
+		clauseBreak: cfg.ClauseBreak,
+		speakers:    make(map[string]Voice),
+	}
+	byName := make(map[string]Voice)
+	for _, v := range cfg.Voices {
+		byName[v.Name] = v
+		if v.Provider == provider {
+			p.voices = append(p.voices, v)
+		}
+	}
+	if len(p.voices) == 0 {
+		return nil, fmt.Errorf("no voices for provider %s", provider)
+	}
+	for kind, name := range cfg.Kinds {
+		if !slices.Contains(kinds, kind) {
+			continue
+		}
+		v := byName[name]
+		if v.Provider != provider {
+			return nil, fmt.Errorf("kinds: voice %s of kind %s is a %s voice, %s audio is read by %s", name, kind, v.Provider, kind, provider)
+		}
+		p.kinds[kind] = v
+	}
+	if !slices.Contains(kinds, KindSentence) {
+		return p, nil
+	}
+	for speaker, name := range cfg.Speakers {
+		v := byName[name]
+		if v.Provider != provider {
+			return nil, fmt.Errorf("speakers: voice %s of speaker %s is a %s voice, dialogues are read by %s", name, speaker, v.Provider, provider)
+		}
+		p.speakers[speaker] = v
+	}
+	return p, nil
+}
+
+// Kind returns the voice set for kind.
+func (p *Policy) Kind(kind Kind) (Voice, bool) {
+	v, ok := p.kinds[kind]
+	return v, ok
+}
+
+// Rate returns the speaking rate of kind, DefaultRate if it is not set.
+func (p *Policy) Rate(kind Kind) float64 {
+	if rate, ok := p.rates[kind]; ok {
+		return rate
+	}
+	return DefaultRate
+}
+
+// Breaks returns the pause between words and after clauses.
+func (p *Policy) Breaks() (time.Duration, time.Duration) {
+	return p.wordBreak, p.clauseBreak
+}
+
+// Text returns the same voice for the same text in every run.
+func (p *Policy) Text(text string) Voice {
+	h := fnv.New32a()
+	h.Write([]byte(text))
+	return p.voices[h.Sum32()%uint32(len(p.voices))]
+}
+
+// Speaker returns the voice of a dialogue speaker. Speakers without a configured voice
+// get the least used voice in order of appearance, alternating the gender, so the
+// speakers of a dialogue are easy to tell apart.
+func (p *Policy) Speaker(speaker string) Voice {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v, ok := p.speakers[speaker]; ok {
+		return v
+	}
+	used := make(map[string]int)
+	for _, v := range p.speakers {
+		used[v.Name]++
+	}
+	best := p.voices[0]
+	for _, v := range p.voices[1:] {
+		if used[v.Name] < used[best.Name] ||
+			used[v.Name] == used[best.Name] && best.Gender == p.lastGender && v.Gender != p.lastGender {
+			best = v
+		}
+	}
+	p.speakers[speaker] = best
+	p.lastGender = best.Gender
+	return best
+}
@@ -2,14 +2,21 @@ package card
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/fbngrm/zh-anki/pkg/cedict"
 	"github.com/fbngrm/zh-anki/pkg/cjkvi"
 	"github.com/fbngrm/zh-anki/pkg/components"
+	"github.com/fbngrm/zh-anki/pkg/etymology"
+	"github.com/fbngrm/zh-anki/pkg/frequency"
 	"github.com/fbngrm/zh-anki/pkg/heisig"
 	"github.com/fbngrm/zh-anki/pkg/hsk"
+	"github.com/fbngrm/zh-anki/pkg/ignore"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+	"github.com/fbngrm/zh-anki/pkg/pinyin"
+	"github.com/fbngrm/zh-anki/pkg/strokes"
 	"github.com/fbngrm/zh-anki/pkg/translate"
 	"github.com/fbngrm/zh-mnemonics/mnemonic"
 	"golang.org/x/exp/slog"
@@ -20,12 +27,20 @@ const dictSrc = "./pkg/heisig/traditional.txt"
 const cjkviSrc = "./pkg/cjkvi/ids.txt"
 const cedictSrc = "./pkg/cedict/cedict_1_0_ts_utf-8_mdbg.txt"
 const hskSrc = "./pkg/hsk/3.0"
+const wordFrequencySrc = "./pkg/frequency/global_wordfreq.release_UTF-8.txt"
+
+// make me a hanzi graphics.txt, not part of the repo because of its size
+const strokesSrc = "./pkg/strokes/graphics.txt"
+
+// make me a hanzi dictionary.txt, not part of the repo because of its size
+const etymologySrc = "./pkg/etymology/dictionary.txt"
 
 type Example struct {
 	Chinese string `json:"chinese"`
 	Pinyin  string `json:"hsk_pinyin"`
 	English string `json:"hsk_en"`
 	Audio   string `json:"audio"`
+	Voice   string `json:"voice"`
 }
 
 type CedictEntry struct {
@@ -33,14 +48,22 @@ type CedictEntry struct {
 	CedictEnglish string `json:"cedict_en"`
 }
 
+// LLMEntry is used for words that are in none of the dictionaries.
+type LLMEntry struct {
+	LLMPinyin  string `json:"llm_pinyin"`
+	LLMEnglish string `json:"llm_en"`
+}
+
 type HSKEntry struct {
 	HSKPinyin  string `json:"hsk_pinyin"`
 	HSKEnglish string `json:"hsk_en"`
+	HSKLevel   string `json:"hsk_level"`
 }
 
 type Component struct {
 	SimplifiedChinese string
 	English           string
+	Pinyin            string // only set for phonetic components
 }
 
 type DictEntry struct {
@@ -50,6 +73,7 @@ type DictEntry struct {
 	Traditional    string
 	MnemonicBase   string
 	Pronounciation string
+	Level          string // hsk level
 }
 
 type Card struct {
@@ -62,6 +86,16 @@ type Card struct {
 	Pronounciation     string
 	Translation        string // this is supposed to come from data/translations file
 	Tones              []string
+	StrokeCount        int    // 0 if the character is missing in the strokes dataset
+	StrokeOrder        string // svg stroke order diagram
+	EtymologyType      string
+	EtymologyHint      string
+	Semantic           Component   // the component that carries the meaning
+	Phonetic           Component   // the component that gives the sound
+	PhoneticSeries     []string    // other characters with the same phonetic component, most frequent first, capped
+	Confusables        []Component // known characters that look similar
+	Homophones         []Component // known characters with the same toneless pinyin
+	HSKLevel           string      // lowest hsk level of the word, empty if it is not in hsk
 }
 
 type Builder struct {
@@ -70,9 +104,26 @@ type Builder struct {
 	HeisigDict       map[string]heisig.Entry
 	CedictDict       map[string][]cedict.Entry
 	ComponentsDict   map[string]components.Component
-	WordIndex        []string
 	MnemonicsBuilder *mnemonic.Builder
-	HSKDict          map[string]hsk.Entry
+	HSKDict          map[string][]hsk.Entry
+	StrokesDict      map[string]strokes.Entry
+	EtymologyDict    map[string]etymology.Entry
+	PhoneticIndex    map[string][]string // map[phonetic]chars
+	ComponentIndex   map[string][]string // map[component]chars, inverted CJKVIDecomp
+	HomophoneIndex   map[string][]string // map[toneless pinyin]chars
+	ShapeIndex       map[int][]string    // map[stroke count]chars
+	WordIndex        *frequency.WordIndex
+	// confusables and homophones are limited to characters that are already known.
+	// if Known is nil, none are added to the cards.
+	Known ignore.Ignored
+	// asked for words that are in none of the dictionaries, e.g. slang or names.
+	// if Fallback is nil, no cards are built for these words.
+	Fallback Fallback
+}
+
+// Fallback looks up words that are missing from the dictionaries.
+type Fallback interface {
+	LookupWord(word string) (*openai.WordEntry, error)
 }
 
 func NewBuilder(mnemonicsSrc string) (*Builder, error) {
@@ -105,6 +156,22 @@ func NewBuilder(mnemonicsSrc string) (*Builder, error) {
 	if err != nil {
 		return nil, err
 	}
+	wordIndex, err := frequency.NewWordIndex(wordFrequencySrc)
+	if err != nil {
+		return nil, err
+	}
+	// the strokes dataset is optional, cards are built without stroke order if it is missing
+	strokesDict, err := strokes.NewDict(strokesSrc)
+	if err != nil {
+		slog.Warn("load strokes dataset", "error", err)
+		strokesDict = map[string]strokes.Entry{}
+	}
+	// the etymology dataset is optional, cards are built without semantic/phonetic analysis if it is missing
+	etymologyDict, err := etymology.NewDict(etymologySrc)
+	if err != nil {
+		slog.Warn("load etymology dataset", "error", err)
+		etymologyDict = map[string]etymology.Entry{}
+	}
 
 	return &Builder{
 		HeisigDecomp:     heisigDecomp,
@@ -112,25 +179,57 @@ func NewBuilder(mnemonicsSrc string) (*Builder, error) {
 		HeisigDict:       heisigDict,
 		CedictDict:       cedictDict,
 		ComponentsDict:   componentsDict,
-		WordIndex:        hsk.GetByLevel(hskDict, 1),
 		MnemonicsBuilder: mnBuilder,
 		HSKDict:          hskDict,
+		StrokesDict:      strokesDict,
+		EtymologyDict:    etymologyDict,
+		PhoneticIndex:    etymology.NewPhoneticIndex(etymologyDict),
+		ComponentIndex:   cjkvi.NewComponentIndex(cjkviDecomp),
+		HomophoneIndex:   newHomophoneIndex(cedictDict, hskDict),
+		ShapeIndex:       strokes.NewShapeIndex(strokesDict),
+		WordIndex:        wordIndex,
 	}, nil
 }
 
-func (b *Builder) MustBuild(t *translate.Translations) []*Card {
+// BuildLevel builds the cards for all words of a HSK 3.0 level, ordered so that
+// components come before the characters that contain them and characters come
+// before the words that use them. Words and characters in b.Known are skipped.
+func (b *Builder) BuildLevel(level int, t *translate.Translations) []*Card {
 	cards := []*Card{}
-	for _, word := range b.WordIndex {
-		for _, hanzi := range word {
-			// if not hanzi is already known
-			cards = append(cards, b.GetHanziCard(string(hanzi), t))
-		}
-		if utf8.RuneCountInString(word) > 1 {
-			if c, err := b.GetWordCard(word, t); err != nil {
-				slog.Error(err.Error())
-			} else {
-				cards = append(cards, c)
+	seen := map[string]struct{}{}
+	var addHanzi func(hanzi string)
+	addHanzi = func(hanzi string) {
+		if _, ok := seen[hanzi]; ok {
+			return
+		}
+		seen[hanzi] = struct{}{}
+		for _, c := range b.getDecomposition(hanzi) {
+			// we only add components that we can explain
+			if _, _, err := b.lookupDict(c); err != nil {
+				continue
 			}
+			addHanzi(c)
+		}
+		if b.isKnown(hanzi) {
+			return
+		}
+		cards = append(cards, b.GetHanziCard(hanzi, t))
+	}
+	for _, word := range hsk.GetByLevel(b.HSKDict, level) {
+		for _, hanzi := range word {
+			addHanzi(string(hanzi))
+		}
+		if utf8.RuneCountInString(word) == 1 {
+			continue
+		}
+		if _, ok := seen[word]; ok || b.isKnown(word) {
+			continue
+		}
+		seen[word] = struct{}{}
+		if c, err := b.GetWordCard(word, t); err != nil {
+			slog.Error(err.Error())
+		} else {
+			cards = append(cards, c)
 		}
 	}
 	return cards
@@ -139,7 +238,10 @@ func (b *Builder) MustBuild(t *translate.Translations) []*Card {
 func (b *Builder) GetWordCard(word string, t *translate.Translations) (*Card, error) {
 	d, tr, err := b.lookupDict(word)
 	if err != nil {
-		return nil, err
+		if b.Fallback == nil {
+			return nil, err
+		}
+		return b.getFallbackCard(word, t)
 	}
 
 	// we need the hsk pinyin to get the tones
@@ -158,6 +260,54 @@ func (b *Builder) GetWordCard(word string, t *translate.Translations) (*Card, er
 		Components:         b.getWordComponents(word),
 		Translation:        t.Lookup(word),
 		Tones:              tones,
+		HSKLevel:           hsk.LowestLevel(b.HSKDict[word]),
+	}, nil
+}
+
+// getFallbackCard builds the card from the answer of the LLM, the dict entries are
+// marked as llm.
+func (b *Builder) getFallbackCard(word string, t *translate.Translations) (*Card, error) {
+	e, err := b.Fallback.LookupWord(word)
+	if err != nil {
+		return nil, fmt.Errorf("no results in lookup of word %s, fallback: %w", word, err)
+	}
+	slog.Info("word looked up with llm", "word", word, "pinyin", e.Pinyin)
+
+	trad := e.Traditional
+	if trad == "" {
+		trad = word
+	}
+
+	// the llm explains characters the dictionaries don't know
+	components := b.getWordComponents(word)
+	for i, c := range components {
+		if c.English != "" {
+			continue
+		}
+		for _, llmChar := range e.Chars {
+			if llmChar.Ch == c.SimplifiedChinese {
+				components[i].English = llmChar.En
+				break
+			}
+		}
+	}
+
+	return &Card{
+		SimplifiedChinese:  word,
+		TraditionalChinese: trad,
+		DictEntries: map[string]map[string]DictEntry{
+			"llm": {
+				e.Pinyin: {
+					Src:         "llm",
+					English:     strings.Join(e.Definitions, ", "),
+					Pinyin:      e.Pinyin,
+					Traditional: trad,
+				},
+			},
+		},
+		Components:  components,
+		Translation: t.Lookup(word),
+		Tones:       getTones(e.Pinyin),
 	}, nil
 }
 
@@ -184,6 +334,17 @@ func (b *Builder) GetHanziCard(hanzi string, t *translate.Translations) *Card {
 			break
 		}
 	}
+
+	strokeCount, strokeOrder := 0, ""
+	if s, ok := b.StrokesDict[hanzi]; ok {
+		strokeCount = s.Count()
+		strokeOrder = strokes.SVG(s, true)
+	} else {
+		slog.Debug("no stroke order found", "hanzi", hanzi)
+	}
+
+	e := b.EtymologyDict[hanzi].Etymology
+
 	return &Card{
 		SimplifiedChinese:  hanzi,
 		TraditionalChinese: trad,
@@ -194,7 +355,238 @@ func (b *Builder) GetHanziCard(hanzi string, t *translate.Translations) *Card {
 		Pronounciation:     pronounciation,
 		Translation:        t.Lookup(hanzi),
 		Tones:              tones,
+		StrokeCount:        strokeCount,
+		StrokeOrder:        strokeOrder,
+		EtymologyType:      e.Type,
+		EtymologyHint:      e.Hint,
+		Semantic:           b.getComponent(e.Semantic),
+		Phonetic:           b.getPhoneticComponent(e.Phonetic),
+		PhoneticSeries:     b.getPhoneticSeries(hanzi, e.Phonetic),
+		Confusables:        b.getConfusables(hanzi),
+		Homophones:         b.getHomophones(hanzi),
+		HSKLevel:           hsk.LowestLevel(b.HSKDict[hanzi]),
+	}
+}
+
+func (b *Builder) getComponent(c string) Component {
+	if c == "" {
+		return Component{}
+	}
+	entries, _, err := b.lookupDict(c)
+	if err != nil {
+		slog.Warn(fmt.Sprintf("get component %s: %v", c, err))
+	}
+	e := []string{}
+	for _, entry := range entries {
+		for _, result := range entry {
+			e = append(e, result.English)
+		}
+	}
+	return Component{
+		SimplifiedChinese: c,
+		English:           strings.Join(e, ", "),
+	}
+}
+
+func (b *Builder) getPhoneticComponent(c string) Component {
+	component := b.getComponent(c)
+	if e, ok := b.EtymologyDict[c]; ok {
+		component.Pinyin = strings.Join(e.Pinyin, ", ")
+	}
+	return component
+}
+
+// the phonetic series contains the characters the etymology dataset lists with the
+// same phonetic component. characters unknown to the dataset are added if the
+// phonetic is one of their components in the cjkvi decomposition. the most frequent
+// characters are kept.
+func (b *Builder) getPhoneticSeries(hanzi, phonetic string) []string {
+	if phonetic == "" {
+		return nil
+	}
+	seen := map[string]struct{}{hanzi: {}}
+	series := []string{}
+	for _, c := range b.PhoneticIndex[phonetic] {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		series = append(series, c)
+	}
+	for _, c := range b.ComponentIndex[phonetic] {
+		if _, ok := seen[c]; ok {
+			continue
+		}
+		if _, ok := b.EtymologyDict[c]; ok {
+			continue
+		}
+		seen[c] = struct{}{}
+		series = append(series, c)
+	}
+	return b.mostFrequent(series, phoneticSeriesLimit)
+}
+
+// max number of characters in the phonetic series
+const phoneticSeriesLimit = 8
+
+// max number of confusables and homophones added to a card
+const confusablesLimit = 5
+
+// mostFrequent returns the limit most frequent characters, ties are ordered by code point.
+func (b *Builder) mostFrequent(hanzi []string, limit int) []string {
+	sorted := make([]string, len(hanzi))
+	copy(sorted, hanzi)
+	sort.Strings(sorted)
+	sorted = b.WordIndex.SortByFrequency(sorted)
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+	return sorted
+}
+
+func newHomophoneIndex(cedictDict map[string][]cedict.Entry, hskDict map[string][]hsk.Entry) map[string][]string {
+	index := make(map[string][]string)
+	seen := make(map[string]struct{})
+	add := func(hanzi, reading string) {
+		if utf8.RuneCountInString(hanzi) != 1 {
+			return
+		}
+		toneless := pinyin.Toneless(reading)
+		if _, ok := seen[toneless+hanzi]; ok {
+			return
+		}
+		seen[toneless+hanzi] = struct{}{}
+		index[toneless] = append(index[toneless], hanzi)
 	}
+	for hanzi, entries := range cedictDict {
+		for _, e := range entries {
+			add(hanzi, e.Readings)
+		}
+	}
+	for hanzi, entries := range hskDict {
+		for _, e := range entries {
+			add(hanzi, e.Pinyin)
+		}
+	}
+	for _, chars := range index {
+		sort.Strings(chars)
+	}
+	return index
+}
+
+func (b *Builder) isKnown(hanzi string) bool {
+	_, ok := b.Known[hanzi]
+	return ok
+}
+
+// confusables are known characters that either share components with the same
+// number of components, e.g. 睛 and 晴, or have a similar shape according to the
+// strokes dataset, e.g. 已, 己 and 巳.
+func (b *Builder) getConfusables(hanzi string) []Component {
+	if b.Known == nil {
+		return nil
+	}
+	decomp := b.getDecomposition(hanzi)
+	candidates := map[string]struct{}{}
+	for _, d := range decomp {
+		for _, c := range b.ComponentIndex[d] {
+			if c == hanzi || !b.isKnown(c) {
+				continue
+			}
+			if sharesComponents(decomp, b.getDecomposition(c)) {
+				candidates[c] = struct{}{}
+			}
+		}
+	}
+	if s, ok := b.StrokesDict[hanzi]; ok {
+		for _, c := range b.ShapeIndex[s.Count()] {
+			if c == hanzi || !b.isKnown(c) {
+				continue
+			}
+			if strokes.Similar(s, b.StrokesDict[c]) {
+				candidates[c] = struct{}{}
+			}
+		}
+	}
+	return b.toComponents(candidates)
+}
+
+// homophones are known characters with the same pinyin, ignoring tones.
+func (b *Builder) getHomophones(hanzi string) []Component {
+	if b.Known == nil {
+		return nil
+	}
+	readings := []string{}
+	for _, e := range b.CedictDict[hanzi] {
+		readings = append(readings, e.Readings)
+	}
+	for _, h := range b.HSKDict[hanzi] {
+		readings = append(readings, h.Pinyin)
+	}
+	candidates := map[string]struct{}{}
+	for _, r := range readings {
+		for _, c := range b.HomophoneIndex[pinyin.Toneless(r)] {
+			if c == hanzi || !b.isKnown(c) {
+				continue
+			}
+			candidates[c] = struct{}{}
+		}
+	}
+	return b.toComponents(candidates)
+}
+
+// the most frequent characters are kept, so the ones most likely to be mixed up.
+func (b *Builder) toComponents(hanzi map[string]struct{}) []Component {
+	candidates := make([]string, 0, len(hanzi))
+	for h := range hanzi {
+		candidates = append(candidates, h)
+	}
+	sorted := b.mostFrequent(candidates, confusablesLimit)
+	components := make([]Component, len(sorted))
+	for i, h := range sorted {
+		components[i] = b.getComponent(h)
+		components[i].Pinyin = b.getPinyin(h)
+	}
+	return components
+}
+
+func (b *Builder) getPinyin(hanzi string) string {
+	if h, ok := b.HSKDict[hanzi]; ok {
+		return h[0].Pinyin
+	}
+	if h, ok := b.HeisigDict[hanzi]; ok {
+		return h.Pinyin
+	}
+	readings := []string{}
+	for _, e := range b.CedictDict[hanzi] {
+		readings = append(readings, e.Readings)
+	}
+	return strings.Join(readings, ", ")
+}
+
+func (b *Builder) getDecomposition(hanzi string) []string {
+	if d := b.HeisigDecomp[hanzi]; len(d) > 0 {
+		return d
+	}
+	return b.CJKVIDecomp[hanzi]
+}
+
+// reports whether two decompositions have the same number of components and
+// at least half of them in common.
+func sharesComponents(a, b []string) bool {
+	if len(a) != len(b) || len(a) < 2 {
+		return false
+	}
+	shared := 0
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				shared++
+				break
+			}
+		}
+	}
+	return shared*2 >= len(a)
 }
 
 func (b *Builder) getWordComponents(word string) []Component {
@@ -264,23 +656,36 @@ func (b *Builder) lookupDict(word string) (map[string]map[string]DictEntry, stri
 	entries := map[string]map[string]DictEntry{}
 	t := ""
 
-	// lookup in HSK dict
-	if h, ok := b.HSKDict[word]; ok {
-		m := mnemonic.Mnemonic{}
-		var err error
-		if utf8.RuneCountInString(word) == 1 {
-			m, err = b.MnemonicsBuilder.Get(h.Pinyin)
-			if err != nil {
-				slog.Warn(fmt.Sprintf("hsk: get mnemonic base for: %s", h.Pinyin))
-			}
-		}
+	// lookup in HSK dict, a word can occur with different pinyin or in several levels
+	if hh, ok := b.HSKDict[word]; ok {
 		r := map[string]DictEntry{}
-		r[h.Pinyin] = DictEntry{
-			Src:            "hsk",
-			English:        h.Meaning,
-			Pinyin:         h.Pinyin,
-			MnemonicBase:   m.Mnemonic,
-			Pronounciation: m.Pronounciation,
+		for _, h := range hh {
+			if e, ok := r[h.Pinyin]; ok {
+				if hsk.MinLevel(h.Level) < hsk.MinLevel(e.Level) {
+					e.Level = h.Level
+				}
+				if !strings.Contains(e.English, h.Meaning) {
+					e.English = e.English + "; " + h.Meaning
+				}
+				r[h.Pinyin] = e
+				continue
+			}
+			m := mnemonic.Mnemonic{}
+			var err error
+			if utf8.RuneCountInString(word) == 1 {
+				m, err = b.MnemonicsBuilder.Get(h.Pinyin)
+				if err != nil {
+					slog.Warn(fmt.Sprintf("hsk: get mnemonic base for: %s", h.Pinyin))
+				}
+			}
+			r[h.Pinyin] = DictEntry{
+				Src:            "hsk",
+				English:        h.Meaning,
+				Pinyin:         h.Pinyin,
+				MnemonicBase:   m.Mnemonic,
+				Pronounciation: m.Pronounciation,
+				Level:          h.Level,
+			}
 		}
 		entries["hsk"] = r
 	}
@@ -364,6 +769,7 @@ func GetHSKEntries(card *Card) []HSKEntry {
 			hskEntries = append(hskEntries, HSKEntry{
 				HSKPinyin:  entry.Pinyin,
 				HSKEnglish: entry.English,
+				HSKLevel:   entry.Level,
 			})
 		}
 	}
@@ -383,6 +789,19 @@ func GetCedictEntries(card *Card) []CedictEntry {
 	return cedictEntries
 }
 
+func GetLLMEntries(card *Card) []LLMEntry {
+	llmEntries := make([]LLMEntry, 0)
+	if llm, ok := card.DictEntries["llm"]; ok {
+		for _, entry := range llm {
+			llmEntries = append(llmEntries, LLMEntry{
+				LLMPinyin:  entry.Pinyin,
+				LLMEnglish: entry.English,
+			})
+		}
+	}
+	return llmEntries
+}
+
 // Map tone-marked vowels to their respective tone numbers
 var toneMap = map[rune]string{
 	'ā': "first", 'á': "second", 'ǎ': "third", 'à': "fourth",
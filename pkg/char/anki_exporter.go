@@ -2,6 +2,7 @@ package char
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/fbngrm/zh-anki/pkg/anki"
 	"github.com/fbngrm/zh-anki/pkg/card"
@@ -49,29 +50,74 @@ func Export(deckName string, c Char, i ignore.Ignored) error {
 		trans = c.Translation + "<br>" + "<br>"
 	}
 
+	strokeCount, strokeOrder := "", ""
+	if c.StrokeOrder != "" {
+		strokeCount = fmt.Sprintf("%d strokes", c.StrokeCount)
+		strokeOrder = fmt.Sprintf(`<img src="%s">`, c.StrokeOrder)
+	}
+
+	etymologyHeader, etymology := "", ""
+	if c.Semantic.SimplifiedChinese != "" || c.Phonetic.SimplifiedChinese != "" {
+		etymologyHeader = "Etymology<br>"
+		etymology = etymologyToString(c) + "<br>"
+	}
+
+	phoneticSeriesHeader, phoneticSeries := "", ""
+	if len(c.PhoneticSeries) >= 1 {
+		phoneticSeriesHeader = "Phonetic Series<br>"
+		phoneticSeries = strings.Join(c.PhoneticSeries, " ") + "<br><br>"
+	}
+
+	dontConfuseHeader, dontConfuse := "", ""
+	if len(c.Confusables) >= 1 || len(c.Homophones) >= 1 {
+		dontConfuseHeader = "Don't confuse with<br>"
+		dontConfuse = confusablesToString(c.Confusables, "looks similar") +
+			confusablesToString(c.Homophones, "sounds alike") + "<br>"
+	}
+
+	hskLevel := ""
+	if c.HSKLevel != "" {
+		hskLevel = "HSK " + c.HSKLevel
+	}
+
+	frequencyRank := ""
+	if c.FrequencyRank > 0 {
+		frequencyRank = fmt.Sprintf("#%d most frequent", c.FrequencyRank)
+	}
+
 	noteFields := map[string]string{
-		"Chinese":           c.Chinese,
-		"CedictHeader":      cedictHeader,
-		"CedictPinyin1":     cedictPinyin1,
-		"CedictEnglish1":    cedictEn1,
-		"CedictPinyin2":     cedictPinyin2,
-		"CedictEnglish2":    cedictEn2,
-		"CedictPinyin3":     cedictPinyin3,
-		"CedictEnglish3":    cedictEn3,
-		"HSKHeader":         hskHeader,
-		"HSKPinyin":         hskPinyin,
-		"HSKEnglish":        hskEn,
-		"Audio":             anki.GetAudioPath(c.Audio),
-		"Components":        componentsToString(c.Components),
-		"Traditional":       c.Traditional,
-		"Examples":          c.Example,
-		"MnemonicBase":      c.MnemonicBase,
-		"Mnemonic":          c.Mnemonic,
-		"Pronounciation":    c.Pronounciation,
-		"TranslationHeader": transHeader,
-		"Translation":       trans,
-	}
-	_, err := anki.AddNoteToDeck(deckName, "char_cedict3", noteFields)
+		"Chinese":              c.Chinese,
+		"CedictHeader":         cedictHeader,
+		"CedictPinyin1":        cedictPinyin1,
+		"CedictEnglish1":       cedictEn1,
+		"CedictPinyin2":        cedictPinyin2,
+		"CedictEnglish2":       cedictEn2,
+		"CedictPinyin3":        cedictPinyin3,
+		"CedictEnglish3":       cedictEn3,
+		"HSKHeader":            hskHeader,
+		"HSKPinyin":            hskPinyin,
+		"HSKLevel":             hskLevel,
+		"FrequencyRank":        frequencyRank,
+		"HSKEnglish":           hskEn,
+		"Audio":                anki.GetAudioPath(c.Audio),
+		"Components":           componentsToString(c.Components),
+		"Traditional":          c.Traditional,
+		"Examples":             c.Example,
+		"MnemonicBase":         c.MnemonicBase,
+		"Mnemonic":             c.Mnemonic,
+		"Pronounciation":       c.Pronounciation,
+		"TranslationHeader":    transHeader,
+		"Translation":          trans,
+		"StrokeCount":          strokeCount,
+		"StrokeOrder":          strokeOrder,
+		"EtymologyHeader":      etymologyHeader,
+		"Etymology":            etymology,
+		"PhoneticSeriesHeader": phoneticSeriesHeader,
+		"PhoneticSeries":       phoneticSeries,
+		"DontConfuseHeader":    dontConfuseHeader,
+		"DontConfuse":          dontConfuse,
+	}
+	_, err := anki.AddNoteToDeck(deckName, "char_cedict3", noteFields, c.Tags...)
 	if err != nil {
 		return fmt.Errorf("add char note [%s]: %w", c.Chinese, err)
 	}
@@ -88,3 +134,31 @@ func componentsToString(components []card.Component) string {
 	}
 	return s
 }
+
+func etymologyToString(c Char) string {
+	s := ""
+	if c.Semantic.SimplifiedChinese != "" {
+		s = fmt.Sprintf(`%s
+<a href="https://hanzicraft.com/character/%s">%s</a> = %s (meaning)
+<br/>`, s, c.Semantic.SimplifiedChinese, c.Semantic.SimplifiedChinese, c.Semantic.English)
+	}
+	if c.Phonetic.SimplifiedChinese != "" {
+		s = fmt.Sprintf(`%s
+<a href="https://hanzicraft.com/character/%s">%s</a> = %s (sound)
+<br/>`, s, c.Phonetic.SimplifiedChinese, c.Phonetic.SimplifiedChinese, c.Phonetic.Pinyin)
+	}
+	if c.EtymologyHint != "" {
+		s = fmt.Sprintf("%s%s<br/>", s, c.EtymologyHint)
+	}
+	return s
+}
+
+func confusablesToString(components []card.Component, reason string) string {
+	s := ""
+	for _, c := range components {
+		s = fmt.Sprintf(`%s
+<a href="https://hanzicraft.com/character/%s">%s</a> %s = %s (%s)
+<br/>`, s, c.SimplifiedChinese, c.SimplifiedChinese, c.Pinyin, c.English, reason)
+	}
+	return s
+}
@@ -27,4 +27,16 @@ type Char struct {
 	Mnemonic       string             `yaml:"mnemonic"`
 	Pronounciation string             `yaml:"pronounciation"`
 	Translation    string             `yaml:"translation"` // this is coming from data/translations file
+	StrokeCount    int                `yaml:"stroke_count"`
+	StrokeOrder    string             `yaml:"stroke_order"` // filename of the svg stroke order diagram
+	EtymologyType  string             `yaml:"etymology_type"`
+	EtymologyHint  string             `yaml:"etymology_hint"`
+	Semantic       card.Component     `yaml:"semantic"`
+	Phonetic       card.Component     `yaml:"phonetic"`
+	PhoneticSeries []string           `yaml:"phonetic_series"` // ranked by frequency
+	Confusables    []card.Component   `yaml:"confusables"`
+	Homophones     []card.Component   `yaml:"homophones"`
+	Tags           []string           `yaml:"tags"`
+	HSKLevel       string             `yaml:"hsk_level"`
+	FrequencyRank  int                `yaml:"frequency_rank"` // 0 if the char is not in the frequency index
 }
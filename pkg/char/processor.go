@@ -1,20 +1,26 @@
 package char
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"unicode/utf8"
 
 	"github.com/fbngrm/zh-anki/pkg/audio"
 	"github.com/fbngrm/zh-anki/pkg/card"
 	"github.com/fbngrm/zh-anki/pkg/frequency"
+	"github.com/fbngrm/zh-anki/pkg/media"
 	"github.com/fbngrm/zh-anki/pkg/translate"
+	"golang.org/x/exp/slog"
 )
 
 type Processor struct {
 	IgnoreChars []string
-	Audio       *audio.GCPClient
+	Audio       *audio.Client
 	WordIndex   *frequency.WordIndex
 	CardBuilder *card.Builder
+	// media files like stroke order diagrams are written here, next to the audio files
+	MediaDir string
 }
 
 func (p *Processor) GetAll(word string, getAudio bool, t *translate.Translations) []Char {
@@ -25,7 +31,7 @@ func (p *Processor) GetAll(word string, getAudio bool, t *translate.Translations
 		example := ""
 		isSingleRune := utf8.RuneCountInString(c) == 1
 		if isSingleRune {
-			example = removeRedundant(p.WordIndex.GetExamplesForHanzi(word, 5))
+			example = removeRedundant(p.WordIndex.GetExamplesForHanzi(c, 5))
 		}
 
 		cc := p.CardBuilder.GetHanziCard(c, t)
@@ -42,6 +48,17 @@ func (p *Processor) GetAll(word string, getAudio bool, t *translate.Translations
 			Mnemonic:       cc.Mnemonic,
 			Pronounciation: cc.Pronounciation,
 			Translation:    cc.Translation,
+			StrokeCount:    cc.StrokeCount,
+			StrokeOrder:    p.getStrokeOrder(cc),
+			EtymologyType:  cc.EtymologyType,
+			EtymologyHint:  cc.EtymologyHint,
+			Semantic:       cc.Semantic,
+			Phonetic:       cc.Phonetic,
+			PhoneticSeries: cc.PhoneticSeries,
+			Confusables:    cc.Confusables,
+			Homophones:     cc.Homophones,
+			HSKLevel:       cc.HSKLevel,
+			FrequencyRank:  p.getFrequencyRank(c),
 		})
 	}
 	if !getAudio {
@@ -50,6 +67,11 @@ func (p *Processor) GetAll(word string, getAudio bool, t *translate.Translations
 	return p.getAudio(allChars)
 }
 
+func (p *Processor) getFrequencyRank(hanzi string) int {
+	rank, _ := p.WordIndex.CharRank(hanzi)
+	return rank
+}
+
 // remove redundant
 func removeRedundant(in []string) string {
 	set := make(map[string]struct{})
@@ -63,9 +85,28 @@ func removeRedundant(in []string) string {
 	return strings.Join(out, ", ")
 }
 
+// writes the stroke order diagram to the media dir and returns the filename.
+// returns an empty string if the character is missing in the strokes dataset.
+// the file is replaced atomically, words sharing a char are processed concurrently.
+func (p *Processor) getStrokeOrder(cc *card.Card) string {
+	if cc.StrokeOrder == "" {
+		return ""
+	}
+	filename := media.Filename(cc.SimplifiedChinese, ".svg")
+	if err := os.MkdirAll(p.MediaDir, os.ModePerm); err != nil {
+		slog.Error("create media dir", "error", err)
+		return ""
+	}
+	if err := media.WriteFile(filepath.Join(p.MediaDir, filename), []byte(cc.StrokeOrder)); err != nil {
+		slog.Error("write stroke order diagram", "char", cc.SimplifiedChinese, "error", err)
+		return ""
+	}
+	return filename
+}
+
 func (p *Processor) getAudio(chars []Char) []Char {
 	for y, char := range chars {
-		filename := char.Chinese + ".mp3"
+		filename := media.Filename(char.Chinese, ".mp3")
 		// currently we don't want audio for chars
 		// if err := p.Audio.Fetch(context.Background(), char.Chinese, filename, false); err != nil {
 		// 	fmt.Println(err)
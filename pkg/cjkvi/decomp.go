@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/fbngrm/zh/pkg/encoding"
@@ -52,3 +53,21 @@ func getComponents(ids string) []string {
 	}
 	return components
 }
+
+// NewComponentIndex inverts a decomposition index and maps each component to
+// the characters containing it, sorted by code point.
+func NewComponentIndex(decomp map[string][]string) map[string][]string {
+	index := make(map[string][]string)
+	for hanzi, components := range decomp {
+		for _, c := range components {
+			if c == hanzi {
+				continue
+			}
+			index[c] = append(index[c], hanzi)
+		}
+	}
+	for _, chars := range index {
+		sort.Strings(chars)
+	}
+	return index
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/fbngrm/zh-anki/pkg/audio"
+	"golang.org/x/exp/slog"
+)
+
+// Audio holds the flags of the tts clients, they are the same for all commands.
+type Audio struct {
+	Fake        bool
+	Concurrency int
+	Voices      string
+}
+
+// Register adds the -audio-* and -voices flags to fs.
+func (a *Audio) Register(fs *flag.FlagSet) {
+	fs.BoolVar(&a.Fake, "audio-fake", false, "write silent audio instead of calling azure and gcp, for offline runs")
+	fs.IntVar(&a.Concurrency, "audio-concurrency", 4, "number of parallel requests to azure and gcp, shared by all processors")
+	fs.StringVar(&a.Voices, "voices", "", "yaml file with the voice catalog and the voices per card kind and dialogue speaker")
+}
+
+// NewClients returns the clients that write the audio of words and sentences to
+// audioDir. Words are read by gcp, sentences by azure. The fake synthesizer writes
+// silent audio offline with the same voices, it does not use the audio cache so no
+// silence ends up in it. Both clients share a pool, which bounds the parallel requests
+// and is canceled with ctx. The returned func closes the gcp client.
+func (a *Audio) NewClients(ctx context.Context, audioDir string) (*audio.Client, *audio.Client, func(), error) {
+	voiceConfig, err := audio.LoadVoiceConfig(a.Voices)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	wordVoices, err := audio.NewPolicy(voiceConfig, "gcp", audio.KindWord)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	sentenceVoices, err := audio.NewPolicy(voiceConfig, "azure", audio.KindSentence, audio.KindCloze, audio.KindGrammar, audio.KindExample)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var words, sentences *audio.Client
+	closeAudio := func() {}
+	if a.Fake {
+		words = audio.NewClient(&audio.Fake{}, nil, wordVoices, audioDir, IgnoreChars)
+		sentences = audio.NewClient(&audio.Fake{}, nil, sentenceVoices, audioDir, IgnoreChars)
+	} else {
+		azureApiKey := os.Getenv("SPEECH_KEY")
+		if azureApiKey == "" {
+			return nil, nil, nil, errors.New("environment variable SPEECH_KEY is not set")
+		}
+		azureEndpoint := os.Getenv("AZURE_ENDPOINT")
+		if azureEndpoint == "" {
+			return nil, nil, nil, errors.New("environment variable AZURE_ENDPOINT is not set")
+		}
+		cache, err := audio.NewCache(AudioCacheDir)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		gcp, err := audio.NewGCP(ctx)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		closeAudio = func() {
+			if err := gcp.Close(); err != nil {
+				slog.Error("close gcp client", "error", err)
+			}
+		}
+		words = audio.NewClient(gcp, cache, wordVoices, audioDir, IgnoreChars)
+		sentences = audio.NewClient(audio.NewAzure(azureEndpoint, azureApiKey), cache, sentenceVoices, audioDir, IgnoreChars)
+	}
+	pool := audio.NewPool(ctx, a.Concurrency)
+	words.Pool = pool
+	sentences.Pool = pool
+	sentences.SplitAudio = true
+	return words, sentences, closeAudio, nil
+}
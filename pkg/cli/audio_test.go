@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAudioNewClientsFake(t *testing.T) {
+	a := Audio{Fake: true, Concurrency: 2}
+	words, sentences, closeAudio, err := a.NewClients(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeAudio()
+	if words.Pool == nil || words.Pool != sentences.Pool {
+		t.Error("expected the clients to share a pool")
+	}
+	if words.SplitAudio || !sentences.SplitAudio {
+		t.Error("expected only sentence audio to be split")
+	}
+}
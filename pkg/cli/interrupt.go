@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+// NotifyInterrupt returns a context that is canceled by the first interrupt, which
+// cancels the llm and audio requests. The second interrupt exits immediately.
+func NotifyInterrupt() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+		fmt.Println("interrupted, canceling llm and audio requests")
+	}()
+	return ctx, stop
+}
+
+// ExitIfInterrupted stops the run before the next export once it has been interrupted,
+// so no cards without audio are added.
+func ExitIfInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		fmt.Println("interrupted, nothing more is exported")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"time"
+
+	"github.com/fbngrm/zh-anki/pkg/openai"
+)
+
+// LLM holds the flags of the llm provider, they are the same for all commands.
+type LLM struct {
+	BaseURL     string
+	Model       string
+	Temperature float64
+	Timeout     time.Duration
+	FakeDir     string
+	JSONMode    bool
+	RPM         int
+	TPM         int
+	Prices      string
+	UsageLog    string
+	MaxCost     float64
+}
+
+// Register adds the -llm-* flags and -max-cost to fs.
+func (l *LLM) Register(fs *flag.FlagSet) {
+	fs.StringVar(&l.BaseURL, "llm-url", openai.DefaultBaseURL, "base url of an OpenAI compatible API")
+	fs.StringVar(&l.Model, "llm-model", openai.DefaultModel, "model name")
+	fs.Float64Var(&l.Temperature, "llm-temperature", 1, "sampling temperature")
+	fs.DurationVar(&l.Timeout, "llm-timeout", 2*time.Minute, "timeout of a single request")
+	fs.StringVar(&l.FakeDir, "llm-fake", "", "serve canned responses from this dir instead of calling the API")
+	fs.BoolVar(&l.JSONMode, "llm-json", true, "request JSON objects, disable for servers without response_format support")
+	fs.IntVar(&l.RPM, "llm-rpm", 60, "max requests per minute, 0 means unlimited")
+	fs.IntVar(&l.TPM, "llm-tpm", 60000, "max tokens per minute, 0 means unlimited")
+	fs.StringVar(&l.Prices, "llm-prices", "", "yaml file with prices in USD per 1M input and output tokens per model")
+	fs.StringVar(&l.UsageLog, "llm-usage-log", "./data/llm-usage.jsonl", "token usage and cost of each run are appended to this file")
+	fs.Float64Var(&l.MaxCost, "max-cost", 0, "stop issuing LLM requests once the run has cost this much in USD, 0 means unlimited")
+}
+
+// NewProvider returns the fake provider, which serves canned responses for offline
+// runs, or a provider for an OpenAI compatible API. Local servers do not require an
+// API key. All requests are accounted in the ledger and canceled once ctx is done.
+func (l *LLM) NewProvider(ctx context.Context) (openai.Provider, *openai.Ledger, error) {
+	prices, err := openai.LoadPrices(l.Prices)
+	if err != nil {
+		return nil, nil, err
+	}
+	if l.FakeDir != "" {
+		fake := &openai.Fake{Dir: l.FakeDir}
+		ledger := openai.NewLedger(fake.Model(), prices, l.MaxCost)
+		return openai.NewMetered(fake, ledger), ledger, nil
+	}
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" && l.BaseURL == openai.DefaultBaseURL {
+		return nil, nil, errors.New("environment variable OPENAI_API_KEY is not set")
+	}
+	provider := openai.NewOpenAICompatible(ctx, openai.Config{
+		BaseURL:     l.BaseURL,
+		APIKey:      apiKey,
+		Model:       l.Model,
+		Temperature: l.Temperature,
+		Timeout:     l.Timeout,
+		JSONMode:    l.JSONMode,
+	})
+	ledger := openai.NewLedger(provider.Model(), prices, l.MaxCost)
+	return openai.NewMetered(openai.NewRateLimited(ctx, provider, l.RPM, l.TPM), ledger), ledger, nil
+}
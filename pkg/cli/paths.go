@@ -0,0 +1,17 @@
+package cli
+
+// paths of the local data, they are the same for all commands
+
+const MnemonicsSrc = "/home/f/Dropbox/zh/mnemonics/mnemonics.txt"
+
+const SegmenterCmd = "/home/f/work/src/github.com/fbngrm/stanford-segmenter/segment.sh"
+const SegmenterModel = "pku"
+
+// here we store responses from openai, the tmp output dir will be copied here in the Make target
+const OpenAICacheDir = "/home/f/Dropbox/zh/cache/openai"
+
+// here we store generated audio by the hash of text, voice and rate, see manifest.json
+const AudioCacheDir = "/home/f/Dropbox/zh/cache/audio"
+
+// IgnoreChars are skipped when words are decomposed or read by tts.
+var IgnoreChars = []string{"!", "！", "？", "?", "，", ",", ".", "。", "", " ", "、"}
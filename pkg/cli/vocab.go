@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/fbngrm/zh-anki/pkg/anki"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+	"golang.org/x/exp/slog"
+)
+
+// the anki note field containing the word or character
+const chineseField = "Chinese"
+
+// Vocab holds the flags that limit generated sentences to known words.
+type Vocab struct {
+	Ignored    bool
+	Anki       bool
+	Query      string
+	MaxUnknown int
+}
+
+// Register adds the -vocab* flags and -max-unknown to fs, ignored is the default of
+// -vocab.
+func (v *Vocab) Register(fs *flag.FlagSet, ignored bool) {
+	fs.BoolVar(&v.Ignored, "vocab", ignored, "limit generated sentences to known words from the ignore list")
+	fs.BoolVar(&v.Anki, "vocab-anki", false, "also read known words from the notes in anki (requires AnkiConnect)")
+	fs.StringVar(&v.Query, "vocab-query", `deck:"chinese::*"`, "anki search query for known notes")
+	fs.IntVar(&v.MaxUnknown, "max-unknown", 1, "max number of unknown words per generated sentence")
+}
+
+// NewVocabulary returns the known words of the ignore list and of anki. The words are
+// copied, the ignore list may be updated during the export. Returns nil if sentences
+// are not limited.
+func (v *Vocab) NewVocabulary(ignored map[string]struct{}) (*openai.Vocabulary, error) {
+	if !v.Ignored && !v.Anki {
+		return nil, nil
+	}
+	known := make(map[string]struct{})
+	if v.Ignored {
+		for k := range ignored {
+			known[k] = struct{}{}
+		}
+	}
+	if v.Anki {
+		words, err := LoadFromAnki(v.Query)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range words {
+			known[w] = struct{}{}
+		}
+	}
+	slog.Info("known words", "count", len(known))
+	return &openai.Vocabulary{
+		Known:      known,
+		MaxUnknown: v.MaxUnknown,
+	}, nil
+}
+
+// LoadFromAnki returns the Chinese field of the notes matching query.
+func LoadFromAnki(query string) ([]string, error) {
+	ids, err := anki.FindNotes(query)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := anki.NotesInfo(ids)
+	if err != nil {
+		return nil, err
+	}
+	words := []string{}
+	for _, n := range notes {
+		field, ok := n.Fields[chineseField]
+		if !ok {
+			continue
+		}
+		if w := strings.TrimSpace(field.Value); w != "" {
+			words = append(words, w)
+		}
+	}
+	return words, nil
+}
@@ -1,14 +1,17 @@
 package dialog
 
 type Cloze struct {
-	SentenceFront string `json:"cloze"`
-	SentenceBack  string `json:"chinese"`
-	FileName      string `json:"filename"`
-	Pinyin        string `json:"pinyin"`
-	English       string `json:"english"`
-	Audio         string `json:"audio"`
-	Words         []Word `json:"allWords"`
-	Grammar       string `json:"grammar"`
-	Note          string `json:"note"`
-	Word          Word   `json:"word"`
+	SentenceFront string  `json:"cloze"`
+	SentenceBack  string  `json:"chinese"`
+	FileName      string  `json:"filename"`
+	Pinyin        string  `json:"pinyin"`
+	English       string  `json:"english"`
+	Literal       string  `json:"literal"`
+	Audio         string  `json:"audio"`
+	Voice         string  `json:"voice"`
+	Words         []Word  `json:"allWords"`
+	Gloss         []Gloss `json:"gloss"`
+	Grammar       string  `json:"grammar"`
+	Note          string  `json:"note"`
+	Word          Word    `json:"word"`
 }
@@ -37,6 +37,12 @@ func ExportCloze(deckName string, cl Cloze, i ignore.Ignored) error {
 		cedictEn3 = cl.Word.Cedict[2].CedictEnglish + "<br>" + "<br>"
 		cedictPinyin3 = cl.Word.Cedict[2].CedictPinyin + "<br>"
 	}
+	// words that are in none of the dictionaries are looked up with the LLM
+	if len(cl.Word.Cedict) == 0 && len(cl.Word.LLM) >= 1 {
+		cedictHeader = "LLM<br>"
+		cedictEn1 = cl.Word.LLM[0].LLMEnglish + "<br>" + "<br>"
+		cedictPinyin1 = cl.Word.LLM[0].LLMPinyin + "<br>"
+	}
 
 	hskHeader, hskEn, hskPinyin := "", "", ""
 	if len(cl.Word.HSK) >= 1 {
@@ -83,6 +89,16 @@ func ExportCloze(deckName string, cl Cloze, i ignore.Ignored) error {
 		exSentenceAudio2 = cl.Word.Examples[1].Audio
 	}
 
+	hskLevel := ""
+	if cl.Word.HSKLevel != "" {
+		hskLevel = "HSK " + cl.Word.HSKLevel
+	}
+
+	frequencyRank := ""
+	if cl.Word.FrequencyRank > 0 {
+		frequencyRank = fmt.Sprintf("#%d most frequent", cl.Word.FrequencyRank)
+	}
+
 	noteFields := map[string]string{
 		"Chinese":                cl.Word.Chinese,
 		"CedictHeader":           cedictHeader,
@@ -94,6 +110,8 @@ func ExportCloze(deckName string, cl Cloze, i ignore.Ignored) error {
 		"CedictEnglish3":         cedictEn3,
 		"HSKHeader":              hskHeader,
 		"HSKPinyin":              hskPinyin,
+		"HSKLevel":               hskLevel,
+		"FrequencyRank":          frequencyRank,
 		"HSKEnglish":             hskEn,
 		"Audio":                  anki.GetAudioPath(cl.Word.Audio),
 		"Components":             componentsToString(cl.Word.Components),
@@ -116,11 +134,13 @@ func ExportCloze(deckName string, cl Cloze, i ignore.Ignored) error {
 		"TranslationHeader":      transHeader,
 		"Translation":            trans,
 		// cloze sentence fields
-		"SentenceFront":   strings.ReplaceAll(cl.SentenceFront, " ", ""),
-		"SentenceBack":    strings.ReplaceAll(cl.SentenceBack, " ", ""),
-		"SentencePinyin":  cl.Pinyin,
-		"SentenceEnglish": cl.English,
-		"SentenceAudio":   anki.GetAudioPath(cl.Audio),
+		"SentenceFront":       strings.ReplaceAll(cl.SentenceFront, " ", ""),
+		"SentenceBack":        strings.ReplaceAll(cl.SentenceBack, " ", ""),
+		"SentencePinyin":      cl.Pinyin,
+		"SentenceEnglish":     cl.English,
+		"SentenceLiteral":     cl.Literal,
+		"SentenceInterlinear": interlinearToString(cl.Gloss),
+		"SentenceAudio":       anki.GetAudioPath(cl.Audio),
 	}
 	_, err := anki.AddNoteToDeck(deckName, "cloze", noteFields)
 	if err != nil {
@@ -9,15 +9,22 @@ import (
 
 	"github.com/fbngrm/zh-anki/pkg/audio"
 	"github.com/fbngrm/zh-anki/pkg/ignore"
+	"github.com/fbngrm/zh-anki/pkg/media"
 	"github.com/fbngrm/zh-anki/pkg/openai"
 	"github.com/fbngrm/zh-anki/pkg/translate"
+	"github.com/fbngrm/zh-anki/pkg/verify"
+	"github.com/fbngrm/zh-anki/pkg/worker"
 	"golang.org/x/exp/slog"
 )
 
 type ClozeProcessor struct {
-	Client *openai.Client
+	Client openai.LLM
 	Words  WordProcessor
-	Audio  *audio.AzureClient
+	Audio  *audio.Client
+	// number of clozes decomposed in parallel
+	Concurrency int
+	// cross-checks the pinyin and segmentation of the LLM against CEDICT, optional
+	Verifier *verify.Verifier
 }
 
 func (p *ClozeProcessor) DecomposeFromFile(path, outdir string, t *translate.Translations, dry bool) ([]Cloze, error) {
@@ -29,48 +36,67 @@ func (p *ClozeProcessor) DecomposeFromFile(path, outdir string, t *translate.Tra
 }
 
 func (p *ClozeProcessor) Decompose(clozes []cloze, outdir string, t *translate.Translations, dry bool) []Cloze {
-	var results []Cloze
-	for _, cl := range clozes {
-		slog.Info("=================================")
+	decomposed := worker.Map(clozes, p.Concurrency, func(cl cloze) *Cloze {
 		slog.Info("decompose", "cloze", cl.withoutParenthesis)
 
 		s, err := p.Client.DecomposeSentence(cl.withoutParenthesis)
 		if err != nil {
 			slog.Error("decompose cloze sentence", "error", err.Error())
-			continue
+			return nil
+		}
+		if p.Verifier != nil {
+			for _, issue := range p.Verifier.Sentence(s) {
+				slog.Warn("verify pinyin", "word", issue.Word, "pinyin", issue.Pinyin, "reason", issue.Reason, "corrected", issue.Corrected)
+			}
 		}
 
 		w, err := p.Words.Decompose(Word{Chinese: cl.word}, t, dry)
 		if err != nil {
 			slog.Error("decompose cloze word", "word", cl.word, "error", err.Error())
-			continue
+			return nil
 		}
 
-		results = append(results, Cloze{
+		return &Cloze{
 			SentenceFront: cl.withUnderscores,
 			SentenceBack:  cl.withoutParenthesis,
 			FileName:      cl.filename,
 			English:       s.English,
+			Literal:       s.Literal,
 			Pinyin:        s.Pinyin,
+			Gloss:         getGloss(s.Words, p.Words.Get(s.Words, t)),
 			// Words:         p.Words.Get(s.Words, i, t),
 			Grammar: cl.grammar, // this only works when supplied in the sentences file
 			Note:    cl.note,    // this only works when supplied in the sentences file
 			Word:    *w,
-		})
+		}
+	})
+
+	var results []Cloze
+	for _, cl := range decomposed {
+		if cl != nil {
+			results = append(results, *cl)
+		}
 	}
 	return p.getAudio(results, dry)
 }
 
+// audio is fetched in parallel, the number of requests is bounded by the audio pool
 func (p *ClozeProcessor) getAudio(clozes []Cloze, dry bool) []Cloze {
 	for x, c := range clozes {
-		filename := c.SentenceBack + ".mp3"
-		if !dry {
-			query := p.Audio.PrepareQueryWithRandomVoice(c.SentenceBack, true)
-			if err := p.Audio.Fetch(context.Background(), query, filename, 3); err != nil {
-				slog.Error("fetching audio from azure", "error", err.Error())
-			}
+		clozes[x].Audio = media.Filename(c.SentenceBack, ".mp3")
+	}
+	if dry {
+		return clozes
+	}
+	voices := worker.Map(clozes, p.Concurrency, func(c Cloze) string {
+		voice, err := p.Audio.Fetch(context.Background(), audio.KindCloze, c.SentenceBack, c.Audio, audioHints(c.Gloss, p.Verifier)...)
+		if err != nil {
+			slog.Error("fetch audio", "error", err.Error())
 		}
-		clozes[x].Audio = filename
+		return voice
+	})
+	for x := range clozes {
+		clozes[x].Voice = voices[x]
 	}
 	return clozes
 }
@@ -91,7 +117,7 @@ func (p *ClozeProcessor) ExportJSON(clozes []Cloze, outDir string) {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		outPath := path.Join(outDir, c.FileName+".json")
+		outPath := path.Join(outDir, media.Filename(c.FileName, ".json"))
 		if err := os.WriteFile(outPath, b, 0644); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -0,0 +1,55 @@
+package dialog
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// loadDialogues reads a dialogues file, each line is a sentence prefixed with the
+// speaker, e.g. "A: 你好！". Dialogues are separated by empty lines. The file may be
+// segmented, so whitespace around the speaker is ignored.
+func loadDialogues(path string) []sentence {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("could not open dialogues file: %v", err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	var sentences []sentence
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		speaker, text := splitSpeaker(line)
+		if text == "" {
+			continue
+		}
+		sentences = append(sentences, sentence{
+			text:    text,
+			speaker: speaker,
+		})
+	}
+	return sentences
+}
+
+// splitSpeaker splits the speaker from the sentence. Lines without a speaker, or a
+// colon that is part of the Chinese sentence, return an empty speaker.
+func splitSpeaker(line string) (string, string) {
+	i := strings.IndexAny(line, ":：")
+	if i == -1 {
+		return "", line
+	}
+	speaker := strings.TrimSpace(line[:i])
+	if speaker == "" || strings.IndexFunc(speaker, func(r rune) bool { return unicode.Is(unicode.Han, r) }) != -1 {
+		return "", line
+	}
+	_, size := utf8.DecodeRuneInString(line[i:])
+	return speaker, strings.TrimSpace(line[i+size:])
+}
@@ -0,0 +1,79 @@
+package dialog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitSpeaker(t *testing.T) {
+	testCases := []struct {
+		line    string
+		speaker string
+		text    string
+	}{
+		{line: "A: 你好！", speaker: "A", text: "你好！"},
+		{line: "A：你好！", speaker: "A", text: "你好！"},
+		{line: "Anna ： 你 好 ！", speaker: "Anna", text: "你 好 ！"},
+		{line: "你好！", speaker: "", text: "你好！"},
+		{line: "他说：你好！", speaker: "", text: "他说：你好！"},
+		{line: ": 你好！", speaker: "", text: ": 你好！"},
+		{line: "A:", speaker: "A", text: ""},
+	}
+	for _, tc := range testCases {
+		speaker, text := splitSpeaker(tc.line)
+		if speaker != tc.speaker || text != tc.text {
+			t.Errorf("%q: expected speaker %q and text %q, got %q and %q", tc.line, tc.speaker, tc.text, speaker, text)
+		}
+	}
+}
+
+func TestLoadDialogues(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected []sentence
+	}{
+		{
+			name:    "ascii and full-width colons",
+			content: "A: 你好！\nB：你好吗？\n",
+			expected: []sentence{
+				{text: "你好！", speaker: "A"},
+				{text: "你好吗？", speaker: "B"},
+			},
+		},
+		{
+			name:    "blank lines separate dialogues",
+			content: "A: 你好！\n\n  \nB: 再见！\n\n",
+			expected: []sentence{
+				{text: "你好！", speaker: "A"},
+				{text: "再见！", speaker: "B"},
+			},
+		},
+		{
+			name:    "lines without a speaker",
+			content: "你好！\nA:\n他说：再见。\n",
+			expected: []sentence{
+				{text: "你好！"},
+				{text: "他说：再见。"},
+			},
+		},
+		{
+			name:    "empty file",
+			content: "\n\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "dialogues")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got := loadDialogues(path)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package dialog
+
+import (
+	"html"
+	"strings"
+
+	"github.com/fbngrm/zh-anki/pkg/audio"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+	"github.com/fbngrm/zh-anki/pkg/verify"
+)
+
+// Gloss is a column of the interlinear rendering of a sentence.
+type Gloss struct {
+	Chinese    string `json:"chinese"`
+	Pinyin     string `json:"pinyin"`
+	English    string `json:"english"`
+	Dictionary string `json:"dictionary"`
+}
+
+// getGloss aligns the segmented words of a sentence with their pinyin, the translation
+// in the context of the sentence by the LLM and the first definition of HSK or CEDICT.
+// Ignored chars like punctuation are kept, so the columns cover the whole sentence.
+// The dictionaries fill in the pinyin and translation if the LLM is missing them.
+func getGloss(words []openai.Word, decomposed []Word) []Gloss {
+	dict := make(map[string]Word, len(decomposed))
+	for _, w := range decomposed {
+		dict[w.Chinese] = w
+	}
+	var gloss []Gloss
+	for _, word := range words {
+		if word.Ch == "" {
+			continue
+		}
+		g := Gloss{
+			Chinese: word.Ch,
+			Pinyin:  word.Pi,
+			English: word.En,
+		}
+		if w, ok := dict[word.Ch]; ok {
+			pinyin, definition := dictGloss(w)
+			g.Dictionary = definition
+			if g.Pinyin == "" {
+				g.Pinyin = pinyin
+			}
+			if g.English == "" {
+				g.English = definition
+			}
+		}
+		gloss = append(gloss, g)
+	}
+	return gloss
+}
+
+// dictGloss returns the first reading and definition, HSK before CEDICT.
+func dictGloss(w Word) (string, string) {
+	first := func(definitions string) string {
+		return strings.TrimSpace(strings.SplitN(definitions, ", ", 2)[0])
+	}
+	if len(w.HSK) > 0 {
+		return w.HSK[0].HSKPinyin, first(w.HSK[0].HSKEnglish)
+	}
+	if len(w.Cedict) > 0 {
+		return w.Cedict[0].CedictPinyin, first(w.Cedict[0].CedictEnglish)
+	}
+	return "", ""
+}
+
+// interlinearToString renders the gloss as a table with one column per word and rows
+// for hanzi, pinyin, translation and dictionary definition.
+func interlinearToString(gloss []Gloss) string {
+	if len(gloss) == 0 {
+		return ""
+	}
+	row := func(class string, cell func(Gloss) string) string {
+		var sb strings.Builder
+		sb.WriteString(`<tr class="` + class + `">`)
+		for _, g := range gloss {
+			sb.WriteString("<td>" + html.EscapeString(cell(g)) + "</td>")
+		}
+		sb.WriteString("</tr>")
+		return sb.String()
+	}
+	return `<table class="interlinear">` +
+		row("hanzi", func(g Gloss) string { return g.Chinese }) +
+		row("pinyin", func(g Gloss) string { return g.Pinyin }) +
+		row("gloss", func(g Gloss) string { return g.English }) +
+		row("dictionary", func(g Gloss) string { return g.Dictionary }) +
+		`</table>`
+}
+
+// audioHints returns the pinyin of the words with polyphonic characters, so TTS reads
+// them as on the card, e.g. 银行 yínháng.
+func audioHints(gloss []Gloss, v *verify.Verifier) []audio.Hint {
+	if v == nil {
+		return nil
+	}
+	var hints []audio.Hint
+	for _, g := range gloss {
+		if g.Pinyin != "" && v.Polyphonic(g.Chinese) {
+			hints = append(hints, audio.Hint{Text: g.Chinese, Pinyin: g.Pinyin})
+		}
+	}
+	return hints
+}
@@ -0,0 +1,99 @@
+package dialog
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fbngrm/zh-anki/pkg/card"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+)
+
+func TestGetGloss(t *testing.T) {
+	decomposed := []Word{
+		{Chinese: "银行", HSK: []card.HSKEntry{{HSKPinyin: "yínháng", HSKEnglish: "bank, banking"}}},
+		{Chinese: "去", Cedict: []card.CedictEntry{{CedictPinyin: "qù", CedictEnglish: "to go, to leave"}}},
+		{Chinese: "打卡", LLM: []card.LLMEntry{{LLMPinyin: "dǎkǎ", LLMEnglish: "to check in"}}},
+	}
+	testCases := []struct {
+		name     string
+		words    []openai.Word
+		expected []Gloss
+	}{
+		{
+			name:  "llm translation in context is kept next to the dictionary definition",
+			words: []openai.Word{{Ch: "银行", Pi: "yínháng", En: "the bank"}, {Ch: "去", Pi: "qù", En: "went"}},
+			expected: []Gloss{
+				{Chinese: "银行", Pinyin: "yínháng", English: "the bank", Dictionary: "bank"},
+				{Chinese: "去", Pinyin: "qù", English: "went", Dictionary: "to go"},
+			},
+		},
+		{
+			name:  "missing llm fields fall back to the first dictionary definition",
+			words: []openai.Word{{Ch: "去"}, {Ch: "银行"}, {Ch: "打卡", Pi: "dǎ kǎ"}},
+			expected: []Gloss{
+				{Chinese: "去", Pinyin: "qù", English: "to go", Dictionary: "to go"},
+				{Chinese: "银行", Pinyin: "yínháng", English: "bank", Dictionary: "bank"},
+				// llm entries are not dictionary data
+				{Chinese: "打卡", Pinyin: "dǎ kǎ"},
+			},
+		},
+		{
+			name:  "words missing from the decomposition and punctuation are kept",
+			words: []openai.Word{{Ch: "他", Pi: "tā", En: "he"}, {Ch: "走"}, {Ch: "。"}, {Ch: ""}},
+			expected: []Gloss{
+				{Chinese: "他", Pinyin: "tā", English: "he"},
+				{Chinese: "走"},
+				{Chinese: "。"},
+			},
+		},
+		{
+			name: "no words",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := getGloss(tc.words, decomposed)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestInterlinearToString(t *testing.T) {
+	testCases := []struct {
+		gloss    []Gloss
+		expected string
+	}{
+		{
+			gloss:    nil,
+			expected: "",
+		},
+		{
+			gloss: []Gloss{
+				{Chinese: "银行", Pinyin: "yínháng", English: "the bank", Dictionary: "bank"},
+				{Chinese: "。"},
+			},
+			expected: `<table class="interlinear">` +
+				`<tr class="hanzi"><td>银行</td><td>。</td></tr>` +
+				`<tr class="pinyin"><td>yínháng</td><td></td></tr>` +
+				`<tr class="gloss"><td>the bank</td><td></td></tr>` +
+				`<tr class="dictionary"><td>bank</td><td></td></tr>` +
+				`</table>`,
+		},
+		{
+			gloss: []Gloss{{Chinese: "和", Pinyin: "hé", English: "<and> & with"}},
+			expected: `<table class="interlinear">` +
+				`<tr class="hanzi"><td>和</td></tr>` +
+				`<tr class="pinyin"><td>hé</td></tr>` +
+				`<tr class="gloss"><td>&lt;and&gt; &amp; with</td></tr>` +
+				`<tr class="dictionary"><td></td></tr>` +
+				`</table>`,
+		},
+	}
+	for _, tc := range testCases {
+		if got := interlinearToString(tc.gloss); got != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, got)
+		}
+	}
+}
@@ -9,9 +9,11 @@ type Grammar struct {
 	SentencePinyin  string         `json:"sentencePinyin"`
 	SentenceEnglish string         `json:"sentenceEnglish"`
 	SentenceAudio   string         `json:"sentenceAudio"`
+	SentenceVoice   string         `json:"sentenceVoice"`
 	Pattern         string         `json:"pattern"`
 	Note            string         `json:"note"`
 	Structure       string         `json:"structure"`
 	Examples        []card.Example `json:"examples"`
 	Summary         []string       `json:"summary"`
+	Generated       []string       `json:"generated,omitempty"` // sections generated by the LLM, e.g. note
 }
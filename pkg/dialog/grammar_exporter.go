@@ -57,10 +57,11 @@ func ExportGrammar(deckName string, g Grammar) error {
 			summary += p
 			summary += "</li>"
 		}
-		summary += "</ui>"
+		summary += "</ul>"
 		summary += "<br><br>"
-	} else if len(g.Summary) == 0 {
-		summary = g.Summary[0]
+	} else if len(g.Summary) == 1 {
+		summaryHeader = "Summary<br>"
+		summary = g.Summary[0] + "<br><br>"
 	}
 
 	noteFields := map[string]string{
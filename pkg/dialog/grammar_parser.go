@@ -25,10 +25,14 @@ func loadGrammar(path string) (*grammar, error) {
 		return nil, fmt.Errorf("error reading grammar file: %w", err)
 	}
 
+	// only the cloze sentence is required, missing sections are generated
 	splits := strings.Split(string(content), "---\n")
-	if len(splits) != 5 {
+	if len(splits) > 5 {
 		return nil, errors.New("Invalid file format")
 	}
+	for len(splits) < 5 {
+		splits = append(splits, "")
+	}
 
 	cloze := strings.TrimSpace(splits[0])
 	withoutParenthesis, withUnderscores, pattern, err := processPattern(cloze)
@@ -37,13 +41,10 @@ func loadGrammar(path string) (*grammar, error) {
 	}
 
 	summary := make([]string, 0)
-	if strings.Contains(splits[4], "\n") {
-		points := strings.Split(splits[4], "\n")
-		for _, p := range points {
-			summary = append(summary, strings.TrimSpace(p))
+	for _, p := range strings.Split(splits[4], "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			summary = append(summary, p)
 		}
-	} else {
-		summary = append(summary, splits[4])
 	}
 
 	return &grammar{
@@ -53,7 +54,7 @@ func loadGrammar(path string) (*grammar, error) {
 		Pattern:       pattern,
 		Note:          strings.TrimSpace(splits[1]),
 		Structure:     strings.TrimSpace(splits[2]),
-		Examples:      strings.ReplaceAll(splits[3], " ", ""),
+		Examples:      strings.TrimSpace(strings.ReplaceAll(splits[3], " ", "")),
 		Summary:       summary,
 	}, nil
 
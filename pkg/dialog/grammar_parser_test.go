@@ -0,0 +1,130 @@
+package dialog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fbngrm/zh-anki/pkg/openai"
+)
+
+func TestLoadGrammar(t *testing.T) {
+	testCases := []struct {
+		name     string
+		content  string
+		expected *grammar
+	}{
+		{
+			name:    "all sections",
+			content: "他(一)看(就)懂。\n---\nnote\n---\nA 一 B 就 C\n---\n我 一 到 家 就 睡觉 。\n---\nas soon as\nimmediately\n",
+			expected: &grammar{
+				Cloze:         "他(一)看(就)懂。",
+				SentenceFront: "他___看___懂。",
+				SentenceBack:  "他一看就懂。",
+				Pattern:       "一...就",
+				Note:          "note",
+				Structure:     "A 一 B 就 C",
+				Examples:      "我一到家就睡觉。",
+				Summary:       []string{"as soon as", "immediately"},
+			},
+		},
+		{
+			name:    "only the cloze sentence",
+			content: "我(把)书放在桌子上。\n",
+			expected: &grammar{
+				Cloze:         "我(把)书放在桌子上。",
+				SentenceFront: "我___书放在桌子上。",
+				SentenceBack:  "我把书放在桌子上。",
+				Pattern:       "把",
+				Summary:       []string{},
+			},
+		},
+		{
+			name:    "empty sections and blank summary lines",
+			content: "我(把)书放在桌子上。\n---\n---\nS 把 O V\n---\n---\n\n  \nbǎ construction\n",
+			expected: &grammar{
+				Cloze:         "我(把)书放在桌子上。",
+				SentenceFront: "我___书放在桌子上。",
+				SentenceBack:  "我把书放在桌子上。",
+				Pattern:       "把",
+				Structure:     "S 把 O V",
+				Summary:       []string{"bǎ construction"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "grammar")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadGrammar(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadGrammarErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"no words in parentheses": "我把书放在桌子上。\n",
+		"too many sections":       "我(把)书。\n---\n---\n---\n---\n---\n",
+	} {
+		path := filepath.Join(t.TempDir(), "grammar")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadGrammar(path); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := loadGrammar(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("expected error for a missing file")
+	}
+}
+
+func TestGenerateMissing(t *testing.T) {
+	fakeDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(fakeDir, "grammar_notes"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	notes := `{"note": "generated note", "structure": "S 把 O V", "summary": ["bǎ construction"]}`
+	if err := os.WriteFile(filepath.Join(fakeDir, "grammar_notes", "default.json"), []byte(notes), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prompts, err := openai.LoadPrompts(openai.DefaultPromptVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := openai.NewClient(&openai.Fake{Dir: fakeDir}, openai.NewCache(t.TempDir()), nil, prompts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := &GrammarProcessor{Client: client}
+
+	// sections written by hand are kept
+	gr := &grammar{Cloze: "我(把)书放在桌子上。", Note: "my note"}
+	generated := g.generateMissing(gr)
+	if !reflect.DeepEqual(generated, []string{"structure", "summary"}) {
+		t.Errorf("unexpected generated sections %v", generated)
+	}
+	expected := &grammar{
+		Cloze:     "我(把)书放在桌子上。",
+		Note:      "my note",
+		Structure: "S 把 O V",
+		Summary:   []string{"bǎ construction"},
+	}
+	if !reflect.DeepEqual(gr, expected) {
+		t.Errorf("expected %+v, got %+v", expected, gr)
+	}
+
+	// nothing is generated for complete files
+	if generated := g.generateMissing(gr); generated != nil {
+		t.Errorf("expected nothing to be generated, got %v", generated)
+	}
+}
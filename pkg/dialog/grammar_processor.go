@@ -6,18 +6,20 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/fbngrm/zh-anki/pkg/audio"
 	"github.com/fbngrm/zh-anki/pkg/card"
+	"github.com/fbngrm/zh-anki/pkg/media"
 	"github.com/fbngrm/zh-anki/pkg/openai"
 	"golang.org/x/exp/slog"
 )
 
 type GrammarProcessor struct {
 	Words  WordProcessor
-	Client *openai.Client
-	Audio  *audio.AzureClient
+	Client openai.LLM
+	Audio  *audio.Client
+	// limits example sentences to known words, optional
+	Vocabulary *openai.Vocabulary
 }
 
 func (g *GrammarProcessor) DecomposeFromFile(path string, outdir, deckname string) (Grammar, error) {
@@ -31,7 +33,7 @@ func (g *GrammarProcessor) DecomposeFromFile(path string, outdir, deckname strin
 
 	s, err := g.Client.DecomposeSentence(grammar.SentenceBack)
 	if err != nil {
-		slog.Error("decompose grammar sentence", "error", err.Error())
+		return Grammar{}, fmt.Errorf("decompose grammar sentence: %w", err)
 	}
 
 	var e []card.Example
@@ -44,16 +46,18 @@ func (g *GrammarProcessor) DecomposeFromFile(path string, outdir, deckname strin
 
 		examples := make([]card.Example, len(decompositon.Sentences))
 		for i, s := range decompositon.Sentences {
+			filename, voice := g.getAudio(audio.KindExample, s.Chinese)
 			examples[i] = card.Example{
 				Chinese: s.Chinese,
 				English: s.English,
 				Pinyin:  s.Pinyin,
-				Audio:   g.getAudio(s.Chinese),
+				Audio:   filename,
+				Voice:   voice,
 			}
 		}
 		e = examples
 	} else {
-		examples, err := g.Client.GetExamplesForPattern(grammar.Pattern)
+		examples, err := g.Client.GetExamplesForPattern(grammar.Pattern, g.Vocabulary)
 		slog.Debug("fetch", "grammar examples", grammar.Pattern)
 		if err != nil {
 			slog.Error("fetch example sentences", "word", grammar.Cloze, "err", err)
@@ -61,41 +65,76 @@ func (g *GrammarProcessor) DecomposeFromFile(path string, outdir, deckname strin
 		e = g.getExampleSentences(examples.Examples)
 	}
 
+	generated := g.generateMissing(grammar)
+	sentenceAudio, sentenceVoice := g.getAudio(audio.KindGrammar, grammar.SentenceBack)
+
 	return Grammar{
 		Cloze:           grammar.Cloze,
 		SentenceFront:   grammar.SentenceFront,
 		SentenceBack:    grammar.SentenceBack,
 		SentencePinyin:  s.Pinyin,
 		SentenceEnglish: s.English,
-		SentenceAudio:   g.getAudio(grammar.SentenceBack),
+		SentenceAudio:   sentenceAudio,
+		SentenceVoice:   sentenceVoice,
 		Pattern:         grammar.Pattern,
 		Note:            grammar.Note,
 		Structure:       grammar.Structure,
 		Examples:        e,
 		Summary:         grammar.Summary,
+		Generated:       generated,
 	}, nil
 }
 
+// generateMissing fills in the note, structure and summary if the grammar file leaves
+// them out and returns the names of the generated sections.
+func (g *GrammarProcessor) generateMissing(grammar *grammar) []string {
+	if grammar.Note != "" && grammar.Structure != "" && len(grammar.Summary) > 0 {
+		return nil
+	}
+	notes, err := g.Client.ExplainGrammar(grammar.Cloze)
+	if err != nil {
+		slog.Error("generate grammar notes", "grammar", grammar.Cloze, "err", err)
+		return nil
+	}
+	var generated []string
+	if grammar.Note == "" {
+		grammar.Note = notes.Note
+		generated = append(generated, "note")
+	}
+	if grammar.Structure == "" {
+		grammar.Structure = notes.Structure
+		generated = append(generated, "structure")
+	}
+	if len(grammar.Summary) == 0 {
+		grammar.Summary = notes.Summary
+		generated = append(generated, "summary")
+	}
+	return generated
+}
+
 func (g *GrammarProcessor) getExampleSentences(examples []openai.Word) []card.Example {
 	results := make([]card.Example, len(examples))
 	for i, e := range examples {
+		filename, voice := g.getAudio(audio.KindExample, e.Ch)
 		results[i] = card.Example{
 			Chinese: e.Ch,
 			Pinyin:  e.Pi,
 			English: e.En,
-			Audio:   g.getAudio(e.Ch),
+			Audio:   filename,
+			Voice:   voice,
 		}
 	}
 	return results
 }
 
-func (g *GrammarProcessor) getAudio(s string) string {
-	filename := s + ".mp3"
-	query := g.Audio.PrepareQueryWithRandomVoice(s, true)
-	if err := g.Audio.Fetch(context.Background(), query, filename, 3); err != nil {
+// returns the filename and the voice
+func (g *GrammarProcessor) getAudio(kind audio.Kind, s string) (string, string) {
+	filename := media.Filename(s, ".mp3")
+	voice, err := g.Audio.Fetch(context.Background(), kind, s, filename)
+	if err != nil {
 		slog.Error("fetch example sentences audio", "sentence", s, "err", err)
 	}
-	return filename
+	return filename, voice
 }
 
 func (g *GrammarProcessor) Export(gr Grammar, outDir, deckname string) {
@@ -111,7 +150,7 @@ func (g *GrammarProcessor) ExportCards(deckname string, gr Grammar) {
 
 func (g *GrammarProcessor) ExportJSON(gr Grammar, outDir string) {
 	os.Mkdir(outDir, os.ModePerm)
-	outPath := filepath.Join(outDir, strings.ReplaceAll(gr.Pattern, " ", "")+".json")
+	outPath := filepath.Join(outDir, media.Filename(gr.Pattern, ".json"))
 	b, err := json.MarshalIndent(gr, "", "    ")
 	if err != nil {
 		fmt.Println(err)
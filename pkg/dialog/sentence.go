@@ -1,12 +1,16 @@
 package dialog
 
 type Sentence struct {
-	Chinese      string `yaml:"chinese"`
-	Pinyin       string `yaml:"pinyin"`
-	English      string `yaml:"english"`
-	Audio        string `yaml:"audio"`
-	Words        []Word `yaml:"allWords"`
-	IsSingleRune bool   `yaml:"isSingleRune"`
-	Grammar      string `yaml:"grammar"`
-	Note         string `yaml:"note"`
+	Chinese      string  `yaml:"chinese"`
+	Pinyin       string  `yaml:"pinyin"`
+	English      string  `yaml:"english"`
+	Literal      string  `yaml:"literal"` // word-by-word translation
+	Audio        string  `yaml:"audio"`
+	Voice        string  `yaml:"voice"` // empty for audio of the old cache
+	Words        []Word  `yaml:"allWords"`
+	Gloss        []Gloss `yaml:"gloss"` // all words of the sentence, including ignored ones
+	IsSingleRune bool    `yaml:"isSingleRune"`
+	Grammar      string  `yaml:"grammar"`
+	Note         string  `yaml:"note"`
+	Speaker      string  `yaml:"speaker"` // only set for sentences of a dialogue
 }
@@ -19,13 +19,15 @@ func ExportSentence(deckName string, s Sentence, i ignore.Ignored) error {
 		}
 	}
 	noteFields := map[string]string{
-		"Chinese":    strings.ReplaceAll(s.Chinese, " ", ""),
-		"Pinyin":     s.Pinyin,
-		"English":    s.English,
-		"Audio":      anki.GetAudioPath(s.Audio),
-		"Components": wordsToString(s.Words),
-		"Note":       s.Note,
-		"Grammar":    s.Grammar,
+		"Chinese":     strings.ReplaceAll(s.Chinese, " ", ""),
+		"Pinyin":      s.Pinyin,
+		"English":     s.English,
+		"Literal":     s.Literal,
+		"Interlinear": interlinearToString(s.Gloss),
+		"Audio":       anki.GetAudioPath(s.Audio),
+		"Components":  wordsToString(s.Words),
+		"Note":        s.Note,
+		"Grammar":     s.Grammar,
 	}
 	_, err := anki.AddNoteToDeck(deckName, "sentence", noteFields)
 	if err != nil {
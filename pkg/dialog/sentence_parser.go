@@ -11,6 +11,7 @@ type sentence struct {
 	text    string
 	grammar string
 	note    string
+	speaker string
 }
 
 func loadSentences(path string) []sentence {
@@ -6,49 +6,72 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"strings"
 	"unicode/utf8"
 
 	"github.com/fbngrm/zh-anki/pkg/audio"
 	"github.com/fbngrm/zh-anki/pkg/ignore"
+	"github.com/fbngrm/zh-anki/pkg/media"
 	"github.com/fbngrm/zh-anki/pkg/openai"
 	"github.com/fbngrm/zh-anki/pkg/translate"
+	"github.com/fbngrm/zh-anki/pkg/verify"
+	"github.com/fbngrm/zh-anki/pkg/worker"
 	"golang.org/x/exp/slog"
 )
 
 type SentenceProcessor struct {
-	Client *openai.Client
+	Client openai.LLM
 	Words  WordProcessor
-	Audio  *audio.AzureClient
+	Audio  *audio.Client
+	// number of sentences decomposed in parallel
+	Concurrency int
+	// cross-checks the pinyin and segmentation of the LLM against CEDICT, optional
+	Verifier *verify.Verifier
 }
 
 func (p *SentenceProcessor) DecomposeFromFile(path, outdir string, t *translate.Translations, dry bool) []Sentence {
 	return p.Decompose(loadSentences(path), outdir, t, dry)
 }
 
+// DecomposeDialoguesFromFile decomposes the speaker tagged lines of a dialogues file.
+func (p *SentenceProcessor) DecomposeDialoguesFromFile(path, outdir string, t *translate.Translations, dry bool) []Sentence {
+	return p.Decompose(loadDialogues(path), outdir, t, dry)
+}
+
 func (p *SentenceProcessor) Decompose(sentences []sentence, outdir string, t *translate.Translations, dry bool) []Sentence {
-	var results []Sentence
-	for _, sen := range sentences {
-		slog.Info("=================================")
+	decomposed := worker.Map(sentences, p.Concurrency, func(sen sentence) *Sentence {
 		slog.Info("decompose", "sentence", sen.text)
 
 		s, err := p.Client.DecomposeSentence(sen.text)
 		if err != nil {
 			slog.Error("decompose sentence", "error", err.Error())
-			continue
+			return nil
+		}
+		if p.Verifier != nil {
+			for _, issue := range p.Verifier.Sentence(s) {
+				slog.Warn("verify pinyin", "word", issue.Word, "pinyin", issue.Pinyin, "reason", issue.Reason, "corrected", issue.Corrected)
+			}
 		}
 
-		sentence := &Sentence{
+		words := p.Words.Get(s.Words, t)
+		return &Sentence{
 			Chinese:      sen.text,
 			English:      s.English,
+			Literal:      s.Literal,
 			Pinyin:       s.Pinyin,
-			Words:        p.Words.Get(s.Words, t),
+			Words:        words,
+			Gloss:        getGloss(s.Words, words),
 			IsSingleRune: utf8.RuneCountInString(s.Chinese) == 1,
 			Grammar:      sen.grammar, // this only works when supplied in the sentences file
 			Note:         sen.note,    // this only works when supplied in the sentences file
+			Speaker:      sen.speaker, // this only works when supplied in the dialogues file
 		}
-		results = append(results, *sentence)
+	})
 
+	var results []Sentence
+	for _, s := range decomposed {
+		if s != nil {
+			results = append(results, *s)
+		}
 	}
 	return p.getAudio(results, dry)
 }
@@ -56,28 +79,53 @@ func (p *SentenceProcessor) Decompose(sentences []sentence, outdir string, t *tr
 func (p *SentenceProcessor) Get(sentences []openai.Sentence, t *translate.Translations, dry bool) []Sentence {
 	var results []Sentence
 	for _, s := range sentences {
+		words := p.Words.Get(s.Words, t)
 		results = append(results, Sentence{
 			Chinese:      s.Chinese,
 			English:      s.English,
+			Literal:      s.Literal,
 			Pinyin:       s.Pinyin,
-			Words:        p.Words.Get(s.Words, t),
+			Words:        words,
+			Gloss:        getGloss(s.Words, words),
 			IsSingleRune: utf8.RuneCountInString(s.Chinese) == 1,
 		})
 	}
 	return p.getAudio(results, dry)
 }
 
+// audio is fetched in parallel, the number of requests is bounded by the audio pool
 func (p *SentenceProcessor) getAudio(sentences []Sentence, dry bool) []Sentence {
 	for x, sentence := range sentences {
-		filename := strings.ReplaceAll(sentence.Chinese, " ", "") + ".mp3"
-		if !dry {
-			query := p.Audio.PrepareQueryWithRandomVoice(sentence.Chinese, true)
-			slog.Debug("fetch azure audio", "sentence", sentence.Chinese)
-			if err := p.Audio.Fetch(context.Background(), query, filename, 3); err != nil {
-				slog.Error("fetch audio from azure", "error", err.Error())
-			}
+		sentences[x].Audio = media.Filename(sentence.Chinese, ".mp3")
+	}
+	if dry {
+		return sentences
+	}
+	// speakers get their voices in order of appearance, not in the order the audio
+	// is fetched
+	for _, sentence := range sentences {
+		if sentence.Speaker != "" {
+			p.Audio.Voices.Speaker(sentence.Speaker)
+		}
+	}
+	voices := worker.Map(sentences, p.Concurrency, func(sentence Sentence) string {
+		slog.Debug("fetch audio", "sentence", sentence.Chinese)
+		var voice string
+		var err error
+		hints := audioHints(sentence.Gloss, p.Verifier)
+		// the lines of a speaker in a dialogue are read by the same voice
+		if sentence.Speaker != "" {
+			voice, err = p.Audio.FetchSpeaker(context.Background(), sentence.Speaker, sentence.Chinese, sentence.Audio, hints...)
+		} else {
+			voice, err = p.Audio.Fetch(context.Background(), audio.KindSentence, sentence.Chinese, sentence.Audio, hints...)
+		}
+		if err != nil {
+			slog.Error("fetch audio", "error", err.Error())
 		}
-		sentences[x].Audio = filename
+		return voice
+	})
+	for x := range sentences {
+		sentences[x].Voice = voices[x]
 	}
 	return sentences
 }
@@ -98,7 +146,7 @@ func (p *SentenceProcessor) ExportJSON(sentences []Sentence, outDir string) {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		outPath := path.Join(outDir, s.Chinese+".json")
+		outPath := path.Join(outDir, media.Filename(s.Chinese, ".json"))
 		if err := os.WriteFile(outPath, b, 0644); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
@@ -6,22 +6,27 @@ import (
 )
 
 type Word struct {
-	Chinese      string             `json:"chinese"`
-	English      string             `json:"english"`
-	Cedict       []card.CedictEntry `json:"cedict"`
-	HSK          []card.HSKEntry    `json:"hsk"`
-	Traditional  string             `json:"traditional"`
-	Audio        string             `json:"audio"`
-	Chars        []char.Char
-	IsSingleRune bool             `json:"isSingleRune"`
-	Components   []card.Component `json:"components"`
-	Kangxi       []string
-	Equivalents  string
-	Example      string         `json:"example"`
-	Examples     []card.Example `json:"examples"`
-	MnemonicBase string         `json:"mnemonic_base"`
-	Mnemonic     string         `json:"mnemonic"`
-	Note         string         `json:"note"`
-	Translation  string         `json:"translation"` // this is coming from data/translations file
-	Tones        []string       `json:"tones"`
+	Chinese       string             `json:"chinese"`
+	English       string             `json:"english"`
+	Cedict        []card.CedictEntry `json:"cedict"`
+	HSK           []card.HSKEntry    `json:"hsk"`
+	LLM           []card.LLMEntry    `json:"llm"` // only set for words that are in none of the dictionaries
+	Traditional   string             `json:"traditional"`
+	Audio         string             `json:"audio"`
+	Voice         string             `json:"voice"`
+	Chars         []char.Char
+	IsSingleRune  bool             `json:"isSingleRune"`
+	Components    []card.Component `json:"components"`
+	Kangxi        []string
+	Equivalents   string
+	Example       string         `json:"example"`
+	Examples      []card.Example `json:"examples"`
+	MnemonicBase  string         `json:"mnemonic_base"`
+	Mnemonic      string         `json:"mnemonic"`
+	Note          string         `json:"note"`
+	Translation   string         `json:"translation"` // this is coming from data/translations file
+	Tones         []string       `json:"tones"`
+	Tags          []string       `json:"tags"`
+	HSKLevel      string         `json:"hsk_level"`      // lowest hsk level of the word
+	FrequencyRank int            `json:"frequency_rank"` // 0 if the word is not in the frequency index
 }
@@ -55,6 +55,12 @@ func ExportWord(deckName string, w Word, i ignore.Ignored) error {
 		cedictEn3 = w.Cedict[2].CedictEnglish + "<br>" + "<br>"
 		cedictPinyin3 = w.Cedict[2].CedictPinyin + "<br>"
 	}
+	// words that are in none of the dictionaries are looked up with the LLM
+	if len(w.Cedict) == 0 && len(w.LLM) >= 1 {
+		cedictHeader = "LLM<br>"
+		cedictEn1 = w.LLM[0].LLMEnglish + "<br>" + "<br>"
+		cedictPinyin1 = w.LLM[0].LLMPinyin + "<br>"
+	}
 
 	hskHeader, hskEn, hskPinyin := "", "", ""
 	if len(w.HSK) >= 1 {
@@ -105,6 +111,16 @@ func ExportWord(deckName string, w Word, i ignore.Ignored) error {
 		exSentenceAudio2 = w.Examples[1].Audio
 	}
 
+	hskLevel := ""
+	if w.HSKLevel != "" {
+		hskLevel = "HSK " + w.HSKLevel
+	}
+
+	frequencyRank := ""
+	if w.FrequencyRank > 0 {
+		frequencyRank = fmt.Sprintf("#%d most frequent", w.FrequencyRank)
+	}
+
 	noteFields := map[string]string{
 		"Chinese":                w.Chinese,
 		"CedictHeader":           cedictHeader,
@@ -116,6 +132,8 @@ func ExportWord(deckName string, w Word, i ignore.Ignored) error {
 		"CedictEnglish3":         cedictEn3,
 		"HSKHeader":              hskHeader,
 		"HSKPinyin":              hskPinyin,
+		"HSKLevel":               hskLevel,
+		"FrequencyRank":          frequencyRank,
 		"HSKEnglish":             hskEn,
 		"Audio":                  anki.GetAudioPath(w.Audio),
 		"Components":             componentsToString(w.Components),
@@ -138,7 +156,7 @@ func ExportWord(deckName string, w Word, i ignore.Ignored) error {
 		"ExampleSentenceEn2":     exSentenceEn2,
 		"ExampleSentenceAudio2":  anki.GetAudioPath(exSentenceAudio2),
 	}
-	_, err := anki.AddNoteToDeck(deckName, "word_cedict3", noteFields)
+	_, err := anki.AddNoteToDeck(deckName, "word_cedict3", noteFields, w.Tags...)
 	if err != nil {
 		return fmt.Errorf("add word note [%s]: %w", w.Chinese, err)
 	}
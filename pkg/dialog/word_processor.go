@@ -14,40 +14,54 @@ import (
 	"github.com/fbngrm/zh-anki/pkg/char"
 	"github.com/fbngrm/zh-anki/pkg/frequency"
 	"github.com/fbngrm/zh-anki/pkg/ignore"
+	"github.com/fbngrm/zh-anki/pkg/media"
 	"github.com/fbngrm/zh-anki/pkg/openai"
 	"github.com/fbngrm/zh-anki/pkg/translate"
+	"github.com/fbngrm/zh-anki/pkg/worker"
 	"golang.org/x/exp/slog"
 )
 
 type WordProcessor struct {
-	Chars       char.Processor
-	GCPAudio    *audio.GCPClient
-	AzureAudio  *audio.AzureClient
-	IgnoreChars []string
-	Client      *openai.Client
-	WordIndex   *frequency.WordIndex
-	CardBuilder *card.Builder
+	Chars char.Processor
+	Audio *audio.Client
+	// audio of the example sentences
+	SentenceAudio *audio.Client
+	IgnoreChars   []string
+	Client        openai.LLM
+	WordIndex     *frequency.WordIndex
+	CardBuilder   *card.Builder
+	// number of words decomposed in parallel
+	Concurrency int
+	// limits example sentences to known words, optional
+	Vocabulary *openai.Vocabulary
 }
 
 func (p *WordProcessor) DecomposeFromFile(path, outdir string, t *translate.Translations, dry bool) []Word {
-	words := loadWords(path)
-
-	var newWords []Word
-	for _, word := range words {
+	var words []Word
+	for _, word := range loadWords(path) {
 		if word.Chinese == "" {
 			continue
 		}
 		if contains(p.IgnoreChars, word.Chinese) {
 			continue
 		}
+		words = append(words, word)
+	}
 
+	decomposed := worker.Map(words, p.Concurrency, func(word Word) *Word {
 		w, err := p.Decompose(word, t, dry)
 		if err != nil {
 			slog.Error("decompose", "word", word, "err", err)
-			continue
+			return nil
 		}
+		return w
+	})
 
-		newWords = append(newWords, *w)
+	var newWords []Word
+	for _, w := range decomposed {
+		if w != nil {
+			newWords = append(newWords, *w)
+		}
 	}
 	return newWords
 }
@@ -71,7 +85,7 @@ func (p *WordProcessor) Decompose(w Word, t *translate.Translations, dry bool) (
 		allChars = p.Chars.GetAll(w.Chinese, true, t)
 	}
 
-	examples, err := p.Client.GetExamplesForWord(w.Chinese)
+	examples, err := p.Client.GetExamplesForWord(w.Chinese, p.Vocabulary)
 	if err != nil {
 		slog.Error("fetch example sentences", "word", w.Chinese, "err", err)
 	}
@@ -82,21 +96,25 @@ func (p *WordProcessor) Decompose(w Word, t *translate.Translations, dry bool) (
 	}
 
 	newWord := Word{
-		Chinese:      w.Chinese,
-		Cedict:       card.GetCedictEntries(cc),
-		HSK:          card.GetHSKEntries(cc),
-		Chars:        allChars,
-		IsSingleRune: isSingleRune,
-		Components:   cc.Components,
-		Traditional:  trad,
-		Example:      exampleWords,
-		Examples:     p.getExampleSentences(examples.Examples, dry),
-		MnemonicBase: cc.MnemonicBase,
-		Mnemonic:     cc.Mnemonic,
-		Note:         p.getNote(w.Note, examples.Note),
-		Translation:  cc.Translation,
-		Audio:        p.getAudio(w.Chinese, dry),
-		Tones:        cc.Tones,
+		Chinese:       w.Chinese,
+		Cedict:        card.GetCedictEntries(cc),
+		HSK:           card.GetHSKEntries(cc),
+		LLM:           card.GetLLMEntries(cc),
+		Chars:         allChars,
+		IsSingleRune:  isSingleRune,
+		Components:    cc.Components,
+		Traditional:   trad,
+		Example:       exampleWords,
+		Examples:      p.getExampleSentences(examples.Examples, dry),
+		MnemonicBase:  cc.MnemonicBase,
+		Mnemonic:      cc.Mnemonic,
+		Note:          p.getNote(w.Note, examples.Note),
+		Translation:   cc.Translation,
+		Audio:         getAudioFilename(w.Chinese),
+		Voice:         p.getAudio(w.Chinese, dry),
+		Tones:         cc.Tones,
+		HSKLevel:      cc.HSKLevel,
+		FrequencyRank: p.getFrequencyRank(w.Chinese),
 	}
 	return &newWord, nil
 }
@@ -116,25 +134,27 @@ func (p *WordProcessor) getExampleSentences(examples []openai.Word, dry bool) []
 			Chinese: e.Ch,
 			Pinyin:  e.Pi,
 			English: e.En,
-			Audio:   p.getExampleSentenceAudio(e.Ch, dry),
+			Audio:   getAudioFilename(e.Ch),
+			Voice:   p.getExampleSentenceAudio(e.Ch, dry),
 		}
 	}
 	return results
 }
 
+// returns the voice
 func (p *WordProcessor) getExampleSentenceAudio(s string, dry bool) string {
-	filename := strings.ReplaceAll(s, " ", "") + ".mp3"
-	if !dry {
-		query := p.AzureAudio.PrepareQueryWithRandomVoice(s, true)
-		if err := p.AzureAudio.Fetch(context.Background(), query, filename, 3); err != nil {
-			slog.Error("fetching audio from azure", "error", err.Error())
-		}
+	if dry {
+		return ""
 	}
-	return filename
+	voice, err := p.SentenceAudio.Fetch(context.Background(), audio.KindExample, s, getAudioFilename(s))
+	if err != nil {
+		slog.Error("fetch example sentence audio", "error", err.Error())
+	}
+	return voice
 }
 
-// used for openai data that contains the translation and pinyin; currently we still use hsk and cedict only.
-// TODO: add fallback with openai in case hsk and cedict don't know the word.
+// used for openai data that contains the translation and pinyin; hsk and cedict are
+// preferred, the card builder falls back to the LLM for words they don't know.
 func (p *WordProcessor) Get(words []openai.Word, t *translate.Translations) []Word {
 	var allWords []Word
 	for _, word := range words {
@@ -153,17 +173,28 @@ func (p *WordProcessor) Get(words []openai.Word, t *translate.Translations) []Wo
 
 		cc, err := p.CardBuilder.GetWordCard(word.Ch, t)
 		if err != nil {
-			slog.Error("decompose", "word", word.Ch, "err", err)
+			// we keep the word with the pinyin and translation of the sentence decomposition
+			slog.Warn("decompose, using the llm translation", "word", word.Ch, "err", err)
+			allWords = append(allWords, Word{
+				Chinese:       word.Ch,
+				English:       word.En,
+				LLM:           []card.LLMEntry{{LLMPinyin: word.Pi, LLMEnglish: word.En}},
+				FrequencyRank: p.getFrequencyRank(word.Ch),
+				Chars:         p.Chars.GetAll(word.Ch, false, t),
+			})
 			continue
 		}
 
 		w := Word{
-			Chinese:     word.Ch,
-			English:     word.En, // this comes from openai and is only used in the components of a sentence, which itself is translated by openai
-			Cedict:      card.GetCedictEntries(cc),
-			HSK:         card.GetHSKEntries(cc),
-			Translation: cc.Translation,
-			Chars:       p.Chars.GetAll(word.Ch, false, t),
+			Chinese:       word.Ch,
+			English:       word.En, // this comes from openai and is only used in the components of a sentence, which itself is translated by openai
+			Cedict:        card.GetCedictEntries(cc),
+			HSK:           card.GetHSKEntries(cc),
+			LLM:           card.GetLLMEntries(cc),
+			Translation:   cc.Translation,
+			HSKLevel:      cc.HSKLevel,
+			FrequencyRank: p.getFrequencyRank(word.Ch),
+			Chars:         p.Chars.GetAll(word.Ch, false, t),
 			// IsSingleRune: isSingleRune,
 			// Components:   cc.Components,
 			// Traditional:  cc.TraditionalChinese,
@@ -177,14 +208,25 @@ func (p *WordProcessor) Get(words []openai.Word, t *translate.Translations) []Wo
 	return allWords
 }
 
+func (p *WordProcessor) getFrequencyRank(word string) int {
+	rank, _ := p.WordIndex.Rank(word)
+	return rank
+}
+
+// returns the voice
 func (p *WordProcessor) getAudio(s string, dry bool) string {
-	filename := strings.ReplaceAll(s, " ", "") + ".mp3"
-	if !dry {
-		if err := p.GCPAudio.Fetch(context.Background(), s, filename); err != nil {
-			slog.Error("download GCP audio", "error", err, "word", s)
-		}
+	if dry {
+		return ""
 	}
-	return filename
+	voice, err := p.Audio.Fetch(context.Background(), audio.KindWord, s, getAudioFilename(s))
+	if err != nil {
+		slog.Error("fetch word audio", "error", err, "word", s)
+	}
+	return voice
+}
+
+func getAudioFilename(s string) string {
+	return media.Filename(s, ".mp3")
 }
 
 func (p *WordProcessor) Export(words []Word, outDir, deckname string, i ignore.Ignored) {
@@ -212,7 +254,7 @@ func (p *WordProcessor) ExportJSON(wordsOrChars []Word, outDir string) {
 			fmt.Println(err)
 			os.Exit(1)
 		}
-		outPath := path.Join(outDir, w.Chinese+".json")
+		outPath := path.Join(outDir, media.Filename(w.Chinese, ".json"))
 		if err := os.WriteFile(outPath, b, 0644); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
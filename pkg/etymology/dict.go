@@ -0,0 +1,76 @@
+package etymology
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Etymology describes how a character was formed. For pictophonetic
+// characters, the semantic component carries the meaning and the phonetic
+// component gives the sound.
+type Etymology struct {
+	Type     string `json:"type"` // ideographic, pictographic or pictophonetic
+	Semantic string `json:"semantic"`
+	Phonetic string `json:"phonetic"`
+	Hint     string `json:"hint"`
+}
+
+// Entry is a character in the Make Me a Hanzi dictionary.txt format.
+type Entry struct {
+	Character     string    `json:"character"`
+	Definition    string    `json:"definition"`
+	Pinyin        []string  `json:"pinyin"`
+	Decomposition string    `json:"decomposition"`
+	Radical       string    `json:"radical"`
+	Etymology     Etymology `json:"etymology"`
+}
+
+func NewDict(src string) (map[string]Entry, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("could not open etymology source file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	dict := make(map[string]Entry)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("could not unmarshal etymology entry: %w", err)
+		}
+		if e.Character == "" {
+			continue
+		}
+		dict[e.Character] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return dict, nil
+}
+
+// NewPhoneticIndex maps each phonetic component to the characters that use it,
+// sorted by code point.
+func NewPhoneticIndex(dict map[string]Entry) map[string][]string {
+	index := make(map[string][]string)
+	for c, e := range dict {
+		if e.Etymology.Phonetic == "" {
+			continue
+		}
+		index[e.Etymology.Phonetic] = append(index[e.Etymology.Phonetic], c)
+	}
+	for _, chars := range index {
+		sort.Strings(chars)
+	}
+	return index
+}
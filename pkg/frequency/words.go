@@ -3,14 +3,20 @@ package frequency
 import (
 	"bufio"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 
 	enc "github.com/fbngrm/zh-anki/pkg/encoding"
 )
 
 type WordIndex struct {
-	path  string
-	Words []string
+	path        string
+	Words       []string // most frequent first
+	frequencies []int
+	ranks       map[string]int // map[word]rank, starting at 1
+	byChar      map[rune][]int // map[hanzi]indices of the words containing it
+	charRanks   map[string]int // map[hanzi]rank
 }
 
 func NewWordIndex(frequencyIndexSrc string) (*WordIndex, error) {
@@ -32,22 +38,84 @@ func (i *WordIndex) init() error {
 
 	scanner := bufio.NewScanner(file)
 	index := []string{}
+	frequencies := []int{}
 	for scanner.Scan() {
 		line := scanner.Text()
 		parts := strings.Split(line, ":")
 		if len(parts) != 2 {
 			continue
 		}
+		// the frequency is informational only, the order of the file determines the rank
+		frequency, _ := strconv.Atoi(strings.TrimSpace(parts[1]))
 		index = append(index, parts[0])
+		frequencies = append(frequencies, frequency)
 	}
 	i.Words = index
+	i.frequencies = frequencies
+	i.buildIndex()
 
 	return scanner.Err()
 }
 
+func (i *WordIndex) buildIndex() {
+	i.ranks = make(map[string]int, len(i.Words))
+	i.byChar = make(map[rune][]int)
+	i.charRanks = make(map[string]int)
+	for pos, w := range i.Words {
+		if _, ok := i.ranks[w]; !ok {
+			i.ranks[w] = pos + 1
+		}
+		seen := map[rune]struct{}{}
+		for _, c := range w {
+			if _, ok := seen[c]; ok {
+				continue
+			}
+			seen[c] = struct{}{}
+			i.byChar[c] = append(i.byChar[c], pos)
+		}
+	}
+	// a character's rank is its rank as a word or, if it is not used on its own,
+	// the rank of the most frequent word containing it.
+	for c, positions := range i.byChar {
+		rank := positions[0] + 1
+		if r, ok := i.ranks[string(c)]; ok {
+			rank = r
+		}
+		i.charRanks[string(c)] = rank
+	}
+}
+
+// Rank returns the position of the word in the index, starting at 1.
+func (wi *WordIndex) Rank(word string) (int, bool) {
+	rank, ok := wi.ranks[word]
+	return rank, ok
+}
+
+// Frequency returns the raw frequency of the word or 0 if it is not in the index.
+func (wi *WordIndex) Frequency(word string) int {
+	rank, ok := wi.ranks[word]
+	if !ok || rank > len(wi.frequencies) {
+		return 0
+	}
+	return wi.frequencies[rank-1]
+}
+
+// CharRank returns the rank of a character as a word or, if it is only used in
+// compounds, the rank of the most frequent word containing it.
+func (wi *WordIndex) CharRank(hanzi string) (int, bool) {
+	rank, ok := wi.charRanks[hanzi]
+	return rank, ok
+}
+
 func (wi *WordIndex) GetExamplesForHanzi(hanzi string, count int) []string {
 	examples := []string{}
-	for _, w := range wi.Words {
+	if hanzi == "" {
+		return examples
+	}
+	// all words containing hanzi also contain its first character
+	first := []rune(hanzi)[0]
+	for _, pos := range wi.byChar[first] {
+		w := wi.Words[pos]
 		if !strings.Contains(w, hanzi) {
 			continue
 		}
@@ -59,8 +127,25 @@ func (wi *WordIndex) GetExamplesForHanzi(hanzi string, count int) []string {
 	return examples
 }
 
+// SortByFrequency sorts hanzi by their rank. Hanzi that are not contained in
+// any word come last.
+func (wi *WordIndex) SortByFrequency(hanzi []string) []string {
+	sorted := make([]string, len(hanzi))
+	copy(sorted, hanzi)
+	rank := func(h string) int {
+		if r, ok := wi.CharRank(h); ok {
+			return r
+		}
+		return len(wi.Words) + 1
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+	return sorted
+}
+
 func (wi *WordIndex) GetMostFrequent(limit int) []string {
-	known := []string{}
+	known := map[string]struct{}{}
 	mostFreq := []string{}
 	for i, w := range wi.Words {
 		var skip bool
@@ -70,14 +155,14 @@ func (wi *WordIndex) GetMostFrequent(limit int) []string {
 				skip = true
 				break
 			}
-			if !contains(known, string(c)) {
+			if _, ok := known[string(c)]; !ok {
 				mostFreq = append(mostFreq, string(c))
-				known = append(known, string(c))
+				known[string(c)] = struct{}{}
 			}
 		}
-		if !contains(known, w) && !skip {
+		if _, ok := known[w]; !ok && !skip {
 			mostFreq = append(mostFreq, w)
-			known = append(known, w)
+			known[w] = struct{}{}
 		}
 		if i == limit {
 			break
@@ -85,12 +170,3 @@ func (wi *WordIndex) GetMostFrequent(limit int) []string {
 	}
 	return mostFreq
 }
-
-func contains(s []string, target string) bool {
-	for _, val := range s {
-		if val == target {
-			return true
-		}
-	}
-	return false
-}
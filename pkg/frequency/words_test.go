@@ -59,13 +59,48 @@ func stringSlicesEqual(a, b []string) bool {
 }
 func TestWordIndex_GetMostFrequent(t *testing.T) {
 	wi := WordIndex{
-		Words: []string{"apple", "banana", "cherry", "banana", "apple"},
+		Words: []string{"苹果", "香蕉", "樱桃", "香蕉", "苹果"},
 	}
 
-	expected := []string{"a", "p", "l", "e", "apple", "b", "n", "banana", "c", "h", "r", "y", "cherry"}
+	expected := []string{"苹", "果", "苹果", "香", "蕉", "香蕉", "樱", "桃", "樱桃"}
 	result := wi.GetMostFrequent(100)
 
 	if !reflect.DeepEqual(result, expected) {
 		t.Errorf("Unexpected result. Expected: %v, Got: %v", expected, result)
 	}
 }
+
+func TestWordIndex_Rank(t *testing.T) {
+	wi := WordIndex{
+		Words:       []string{"的", "我们", "是", "你们", "们"},
+		frequencies: []int{500, 400, 300, 200, 100},
+	}
+	wi.buildIndex()
+
+	if rank, ok := wi.Rank("你们"); !ok || rank != 4 {
+		t.Errorf("Expected rank 4, got: %d", rank)
+	}
+	if f := wi.Frequency("是"); f != 300 {
+		t.Errorf("Expected frequency 300, got: %d", f)
+	}
+	// 们 is ranked as a word on its own
+	if rank, ok := wi.CharRank("们"); !ok || rank != 5 {
+		t.Errorf("Expected char rank 5, got: %d", rank)
+	}
+	// 你 is only used in compounds
+	if rank, ok := wi.CharRank("你"); !ok || rank != 4 {
+		t.Errorf("Expected char rank 4, got: %d", rank)
+	}
+	if _, ok := wi.CharRank("他"); ok {
+		t.Errorf("Expected no rank for missing char")
+	}
+
+	expected := []string{"我们", "你们", "们"}
+	if examples := wi.GetExamplesForHanzi("们", 5); !reflect.DeepEqual(examples, expected) {
+		t.Errorf("Unexpected examples. Expected: %v, Got: %v", expected, examples)
+	}
+	expected = []string{"是", "你", "他"}
+	if sorted := wi.SortByFrequency([]string{"他", "你", "是"}); !reflect.DeepEqual(sorted, expected) {
+		t.Errorf("Unexpected order. Expected: %v, Got: %v", expected, sorted)
+	}
+}
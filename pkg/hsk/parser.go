@@ -4,93 +4,225 @@ import (
 	"encoding/csv"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
 
 type Entry struct {
-	Ch      string
-	Pinyin  string
-	Meaning string
-	Level   string
+	Ch           string
+	Pinyin       string
+	Meaning      string
+	Level        string   // 1-6 or 7-9, the name of the source file
+	PartOfSpeech []string // e.g. 名, 动, 形
+	Forms        []string // alternate forms, e.g. 爸 for 爸爸 or 有一些 for 有些
+	Example      string   // usage example for suffixes, e.g. 桌子 for 子
 }
 
-func clean(s string) string {
-	parts := strings.SplitN(s, "｜", 2)
-	s = strings.TrimSpace(parts[0])
-	parts = strings.Split(s, "（")
-	return strings.TrimSpace(parts[0])
+var partsOfSpeech = map[string]struct{}{
+	"名": {}, "动": {}, "形": {}, "副": {}, "量": {}, "代": {},
+	"介": {}, "连": {}, "助": {}, "叹": {}, "数": {},
 }
 
-func NewDict(src string) (map[string]Entry, error) {
+var parenthesis = regexp.MustCompile(`\s*（\s*([^）]*?)\s*）\s*`)
+
+// variant is a single form of a hsk word with its pinyin.
+type variant struct {
+	ch     string
+	pinyin string
+}
+
+// parseRecord returns an entry for each form of a word. Forms are separated by
+// ｜, e.g. 爸爸｜爸. Parenthesis either contain parts of speech, e.g. 白（形),
+// an usage example if they are at the end, e.g. 子（桌子）, or an optional
+// character in the middle of a word, e.g. 有（一）些.
+func parseRecord(record []string, level string) []Entry {
+	forms := strings.Split(stripHomograph(record[0]), "｜")
+	pinyins := strings.Split(stripHomograph(record[1]), "｜")
+
+	var pos []string
+	var example string
+	variants := []variant{}
+	for i, form := range forms {
+		form = strings.TrimSpace(form)
+		pinyin := strings.TrimSpace(pinyins[0])
+		if i < len(pinyins) {
+			pinyin = strings.TrimSpace(pinyins[i])
+		}
+
+		match := parenthesis.FindStringSubmatchIndex(form)
+		if match == nil {
+			variants = append(variants, variant{ch: form, pinyin: pinyin})
+			continue
+		}
+		inner := form[match[2]:match[3]]
+		without := form[:match[0]] + form[match[1]:]
+		pinyinWithout := strings.TrimSpace(parenthesis.ReplaceAllString(pinyin, " "))
+
+		switch {
+		case isPartOfSpeech(inner):
+			pos = strings.Split(inner, "、")
+			variants = append(variants, variant{ch: without, pinyin: pinyinWithout})
+		case match[1] == len(form):
+			example = inner
+			variants = append(variants, variant{ch: without, pinyin: pinyinWithout})
+		default:
+			with := form[:match[0]] + inner + form[match[1]:]
+			pinyinWith := strings.Join(strings.Fields(parenthesis.ReplaceAllString(pinyin, " $1 ")), " ")
+			variants = append(variants,
+				variant{ch: without, pinyin: pinyinWithout},
+				variant{ch: with, pinyin: pinyinWith},
+			)
+		}
+	}
+
+	entries := make([]Entry, 0, len(variants))
+	for _, v := range variants {
+		alternates := []string{}
+		for _, other := range variants {
+			if other.ch != v.ch {
+				alternates = append(alternates, other.ch)
+			}
+		}
+		entries = append(entries, Entry{
+			Ch:           v.ch,
+			Pinyin:       v.pinyin,
+			Meaning:      strings.TrimSpace(record[2]),
+			Level:        level,
+			PartOfSpeech: pos,
+			Forms:        alternates,
+			Example:      example,
+		})
+	}
+	return entries
+}
+
+// homographs are numbered by superscripts in the word and the pinyin, e.g. 面¹ and
+// 面², they are entries of the same word.
+var homograph = strings.NewReplacer("¹", "", "²", "", "³", "", "⁴", "", "⁵", "")
+
+func stripHomograph(s string) string {
+	return strings.Join(strings.Fields(homograph.Replace(s)), " ")
+}
+
+func isPartOfSpeech(s string) bool {
+	for _, p := range strings.Split(s, "、") {
+		if _, ok := partsOfSpeech[p]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// NewDict loads all level files in src. Files are named after the level they
+// contain, e.g. 1.csv or 7-9.csv for the advanced band. Words that occur with
+// different pinyin or in several levels have one entry for each occurrence.
+func NewDict(src string) (map[string][]Entry, error) {
 	files, err := os.ReadDir(src)
 	if err != nil {
 		return nil, err
 	}
-	dict := make(map[string]Entry)
+	dict := make(map[string][]Entry)
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".csv" {
 			continue
 		}
-		filePath := filepath.Join(src, file.Name())
-		file, err := os.Open(filePath)
-		if err != nil {
-			return nil, err
-		}
-		defer file.Close()
-
-		reader := csv.NewReader(file)
-		reader.Comma = '\t'
-
-		records, err := reader.ReadAll()
+		level := strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))
+		records, err := readRecords(filepath.Join(src, file.Name()))
 		if err != nil {
 			return nil, err
 		}
-		for _, record := range records {
-			if len(record) >= 3 {
-				key := clean(record[0])
-				value := Entry{
-					Ch:      record[0],
-					Pinyin:  clean(record[1]),
-					Meaning: record[2],
-					Level:   strings.TrimSuffix(filepath.Base(file.Name()), filepath.Ext(file.Name())),
-				}
-				dict[key] = value
+		for i, record := range records {
+			// skip the header
+			if i == 0 && record[0] == "ch" {
+				continue
+			}
+			if len(record) < 3 {
+				continue
+			}
+			for _, e := range parseRecord(record, level) {
+				dict[e.Ch] = append(dict[e.Ch], e)
 			}
 		}
 	}
 	return dict, nil
 }
 
-func GetByLevel(dict map[string]Entry, level int) []string {
-	all := make(map[string]int)
+func readRecords(path string) ([][]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	return reader.ReadAll()
+}
+
+// MinLevel returns the lower bound of a level, e.g. 7 for the band 7-9.
+func MinLevel(level string) int {
+	l, err := strconv.Atoi(strings.SplitN(level, "-", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return l
+}
+
+// MaxLevel returns the upper bound of a level, e.g. 9 for the band 7-9.
+func MaxLevel(level string) int {
+	parts := strings.SplitN(level, "-", 2)
+	l, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return 0
+	}
+	return l
+}
+
+// LowestLevel returns the lowest level of the entries of a word or an empty string
+// if there are no entries.
+func LowestLevel(entries []Entry) string {
+	lowest := ""
+	for _, e := range entries {
+		if lowest == "" || MinLevel(e.Level) < MinLevel(lowest) {
+			lowest = e.Level
+		}
+	}
+	return lowest
+}
+
+// GetByLevel returns the words of a level, sorted. Levels 7, 8 and 9 return the
+// words of the 7-9 band.
+func GetByLevel(dict map[string][]Entry, level int) []string {
 	byLevel := []string{}
-	for k, entry := range dict {
-		if entry.Level == strconv.Itoa(level) {
-			byLevel = append(byLevel, k)
-			if c, ok := all[k]; ok {
-				all[k] = c + 1
-			} else {
-				all[k] = 1
-			}
-			for _, c := range k {
-				cs := string(c)
-				if cc, ok := all[cs]; ok {
-					all[cs] = cc + 1
-				} else {
-					all[cs] = 1
-				}
+	for k, entries := range dict {
+		for _, e := range entries {
+			if MinLevel(e.Level) <= level && level <= MaxLevel(e.Level) {
+				byLevel = append(byLevel, k)
+				break
 			}
 		}
 	}
-	total := 0
-	for _, c := range all {
-		total += c
-	}
-	// slog.Info(
-	// 	"",
-	// 	"hsk level", level,
-	// 	"distinct words and chars", len(all),
-	// 	"expected cards to add", total)
+	// map iteration order is random, we want the same order on each run
+	sort.Strings(byLevel)
 	return byLevel
 }
+
+// GetByChar returns all words that contain the hanzi, sorted by their lowest level.
+func GetByChar(dict map[string][]Entry, hanzi string) []string {
+	words := []string{}
+	for k := range dict {
+		if strings.Contains(k, hanzi) {
+			words = append(words, k)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		li, lj := MinLevel(LowestLevel(dict[words[i]])), MinLevel(LowestLevel(dict[words[j]]))
+		if li != lj {
+			return li < lj
+		}
+		return words[i] < words[j]
+	})
+	return words
+}
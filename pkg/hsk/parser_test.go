@@ -0,0 +1,74 @@
+package hsk
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRecord(t *testing.T) {
+	testCases := []struct {
+		record   []string
+		expected []Entry
+	}{
+		{
+			record: []string{"爸爸｜爸", "bàba ｜ bà", "dad"},
+			expected: []Entry{
+				{Ch: "爸爸", Pinyin: "bàba", Meaning: "dad", Level: "1", Forms: []string{"爸"}},
+				{Ch: "爸", Pinyin: "bà", Meaning: "dad", Level: "1", Forms: []string{"爸爸"}},
+			},
+		},
+		{
+			record: []string{"多（形、代）", "duō", "many; much; more"},
+			expected: []Entry{
+				{Ch: "多", Pinyin: "duō", Meaning: "many; much; more", Level: "1", PartOfSpeech: []string{"形", "代"}, Forms: []string{}},
+			},
+		},
+		{
+			record: []string{"子（桌子）", "zi （ zhuō zi ）", "noun suffix (table)"},
+			expected: []Entry{
+				{Ch: "子", Pinyin: "zi", Meaning: "noun suffix (table)", Level: "1", Forms: []string{}, Example: "桌子"},
+			},
+		},
+		{
+			record: []string{"有（一）些", "yǒu （ yì ） xiē", "some"},
+			expected: []Entry{
+				{Ch: "有些", Pinyin: "yǒu xiē", Meaning: "some", Level: "1", Forms: []string{"有一些"}},
+				{Ch: "有一些", Pinyin: "yǒu yì xiē", Meaning: "some", Level: "1", Forms: []string{"有些"}},
+			},
+		},
+		{
+			record: []string{"面²（名）", "miàn ²", "face"},
+			expected: []Entry{
+				{Ch: "面", Pinyin: "miàn", Meaning: "face", Level: "1", PartOfSpeech: []string{"名"}, Forms: []string{}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		result := parseRecord(tc.record, "1")
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("Unexpected result for %s. Expected: %+v, Got: %+v", tc.record[0], tc.expected, result)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	dict := map[string][]Entry{
+		"了":  {{Ch: "了", Level: "3"}, {Ch: "了", Level: "1"}},
+		"你好": {{Ch: "你好", Level: "1"}},
+		"倒车": {{Ch: "倒车", Level: "7-9"}},
+	}
+
+	if l := LowestLevel(dict["了"]); l != "1" {
+		t.Errorf("Expected lowest level 1, got: %s", l)
+	}
+	if words := GetByLevel(dict, 8); !reflect.DeepEqual(words, []string{"倒车"}) {
+		t.Errorf("Expected words of band 7-9 for level 8, got: %v", words)
+	}
+	if words := GetByLevel(dict, 1); !reflect.DeepEqual(words, []string{"了", "你好"}) {
+		t.Errorf("Unexpected words for level 1: %v", words)
+	}
+	if words := GetByChar(dict, "车"); !reflect.DeepEqual(words, []string{"倒车"}) {
+		t.Errorf("Unexpected words for char: %v", words)
+	}
+}
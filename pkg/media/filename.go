@@ -0,0 +1,59 @@
+package media
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// maxRunes of the text part of a filename, CJK runes take 3 bytes in UTF-8, so names
+// stay well below the 255 bytes most file systems allow.
+const maxRunes = 40
+
+// hashLen is the number of hex digits of the hash suffix.
+const hashLen = 8
+
+// Filename returns the name of a media or JSON file for text, e.g. 我喜欢你_3f1c9a2b.mp3.
+// Whitespace is stripped off and chars that are not letters, digits or marks are
+// dropped, so the name is safe for file systems and anki [sound:] tags. Long text is
+// truncated. The suffix is a hash of the text without whitespace, so texts that only
+// differ in punctuation or after the truncation get different names.
+func Filename(text, ext string) string {
+	text = strings.Join(strings.Fields(text), "")
+	var name []rune
+	for _, r := range text {
+		if len(name) == maxRunes {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) {
+			name = append(name, r)
+		}
+	}
+	h := sha256.Sum256([]byte(text))
+	suffix := hex.EncodeToString(h[:])[:hashLen]
+	if len(name) == 0 {
+		return suffix + ext
+	}
+	return string(name) + "_" + suffix + ext
+}
+
+var hashSuffix = regexp.MustCompile(`(^|_)[0-9a-f]{8}$`)
+
+// IsFilename reports whether name follows the scheme of Filename.
+func IsFilename(name string) bool {
+	return hashSuffix.MatchString(strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// Rename returns the name by the scheme of Filename for a file of the old scheme, which
+// is named after the text, e.g. 我喜欢你.mp3. It returns false if name follows the
+// new scheme already.
+func Rename(name string) (string, bool) {
+	if IsFilename(name) {
+		return "", false
+	}
+	ext := filepath.Ext(name)
+	return Filename(strings.TrimSuffix(name, ext), ext), true
+}
@@ -0,0 +1,52 @@
+package media
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestFilename(t *testing.T) {
+	name := Filename("我 喜欢 你", ".mp3")
+	if !strings.HasPrefix(name, "我喜欢你_") || !strings.HasSuffix(name, ".mp3") {
+		t.Fatalf("unexpected name %s", name)
+	}
+	if Filename("我喜欢你", ".mp3") != name {
+		t.Fatal("expected whitespace to be ignored")
+	}
+	if Filename("我喜欢你？", ".mp3") == name {
+		t.Fatal("expected a different hash for different punctuation")
+	}
+	if !IsFilename(name) {
+		t.Fatalf("expected %s to follow the scheme", name)
+	}
+
+	for _, text := range []string{`他说："a/b\c?"<>|*`, "[sound:x]", "。。。", ""} {
+		name := Filename(text, ".json")
+		if strings.ContainsAny(name, `/\:*?"<>|[] `) {
+			t.Errorf("unsafe chars in %s", name)
+		}
+		if !IsFilename(name) {
+			t.Errorf("expected %s to follow the scheme", name)
+		}
+	}
+
+	long := strings.Repeat("长", 200)
+	a, b := Filename(long, ".mp3"), Filename(long+"的", ".mp3")
+	if a == b {
+		t.Fatal("expected different names for text that differs after the truncation")
+	}
+	if n := utf8.RuneCountInString(a); n > maxRunes+1+hashLen+len(".mp3") {
+		t.Fatalf("expected truncated name, got %d runes", n)
+	}
+}
+
+func TestRename(t *testing.T) {
+	name, ok := Rename("我喜欢你.mp3")
+	if !ok || name != Filename("我 喜欢 你", ".mp3") {
+		t.Fatalf("unexpected name %s", name)
+	}
+	if _, ok := Rename(name); ok {
+		t.Fatal("expected no rename for the new scheme")
+	}
+}
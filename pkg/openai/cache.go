@@ -1,70 +1,126 @@
 package openai
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v2"
 )
 
+// Key identifies a cached response. Changing the prompt version or the model
+// invalidates old responses.
+type Key struct {
+	Prompt  string
+	Version string
+	Model   string
+	Query   string
+	// constraints of the request, e.g. the target hsk level of example sentences
+	Variant string
+}
+
+// Hash is derived from all fields of the key. Whitespace in the query is ignored,
+// it does not change the meaning of Chinese text.
+func (k Key) Hash() string {
+	h := sha256.New()
+	parts := []string{k.Prompt, k.Version, k.Model, normalize(k.Query)}
+	// keys without variant keep the hash of older cache entries
+	if k.Variant != "" {
+		parts = append(parts, k.Variant)
+	}
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+func normalize(query string) string {
+	return strings.Join(strings.Fields(query), "")
+}
+
+type Usage struct {
+	PromptTokens     int `yaml:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens int `yaml:"completion_tokens" json:"completion_tokens"`
+	TotalTokens      int `yaml:"total_tokens" json:"total_tokens"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+}
+
+// Entry is stored as a yaml file in <dir>/<prompt>/<hash>.yaml
+type Entry struct {
+	Prompt   string    `yaml:"prompt"`
+	Version  string    `yaml:"version"`
+	Model    string    `yaml:"model"`
+	Query    string    `yaml:"query"`
+	Variant  string    `yaml:"variant,omitempty"`
+	Created  time.Time `yaml:"created"`
+	Usage    Usage     `yaml:"usage"`
+	Response string    `yaml:"response"`
+}
+
+func (e Entry) Key() Key {
+	return Key{
+		Prompt:  e.Prompt,
+		Version: e.Version,
+		Model:   e.Model,
+		Query:   e.Query,
+		Variant: e.Variant,
+	}
+}
+
 type Cache struct {
-	dir   string
-	index map[string]struct{}
+	dir string
 }
 
 func NewCache(dir string) *Cache {
 	return &Cache{
-		dir:   dir,
-		index: read(dir),
+		dir: dir,
 	}
 }
 
-func (c *Cache) Lookup(key string) (string, bool) {
-	filename := strings.ReplaceAll(key, " ", "") + ".yaml"
-	if _, ok := c.index[filename]; ok {
-		f, err := os.Open(filepath.Join(c.dir, filename))
-		if err != nil {
-			log.Printf("Failed to open file %s: %v", filename, err)
-			return "", false
-		}
-		data, err := ioutil.ReadAll(f)
-		if err != nil {
-			log.Printf("Failed to read file %s: %v", filename, err)
-			return "", false
-		}
-		return string(data), true
-	}
-	return "", false
+func (c *Cache) path(k Key) string {
+	return filepath.Join(c.dir, k.Prompt, k.Hash()+".yaml")
 }
 
-func (c *Cache) Add(key, val string) {
-	key = strings.ReplaceAll(key, " ", "") + ".yaml"
-	path := filepath.Join(c.dir, key)
-	if err := os.WriteFile(path, []byte(val), 0644); err != nil {
-		fmt.Printf("could not write cache file: %v", err)
-		os.Exit(1)
+func (c *Cache) Lookup(k Key) (Entry, bool) {
+	path := c.path(k)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("read cache file", "file", path, "error", err)
+		}
+		return Entry{}, false
+	}
+	var e Entry
+	if err := yaml.Unmarshal(b, &e); err != nil {
+		slog.Error("unmarshal cache file", "file", path, "error", err)
+		return Entry{}, false
 	}
-	slog.Debug("add openai result to file cache", "file", key)
-	c.index[key] = struct{}{}
+	return e, true
 }
 
-func read(dir string) map[string]struct{} {
-	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		return map[string]struct{}{}
+func (c *Cache) Add(e Entry) error {
+	path := c.path(e.Key())
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("could not create cache dir: %w", err)
 	}
-	files, err := ioutil.ReadDir(dir)
+	b, err := yaml.Marshal(e)
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("could not marshal cache entry: %w", err)
 	}
-
-	filenames := make(map[string]struct{})
-	for _, file := range files {
-		name := strings.ReplaceAll(file.Name(), " ", "")
-		filenames[name] = struct{}{}
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		return fmt.Errorf("could not write cache file: %w", err)
 	}
-	return filenames
+	slog.Debug("add openai result to file cache", "file", path, "query", e.Query)
+	return nil
 }
@@ -1,42 +1,41 @@
 package openai
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
-	"net/http"
 	"strings"
+	"time"
 
 	"github.com/fbngrm/zh-anki/pkg/segment"
 	"golang.org/x/exp/slog"
 )
 
-const decomposeDialogMessage = `Add pinyin to the following sentences written in simplified Chinese. Format the result into a JSON object. The original sentence should be stored in a field called chinese, the English translation should be stored in a field called english and the pinyin should be stored in a field called piniyin. Also split each sentence into words and add a JSON array with these words in a field called words. Each word should be a JSON object, the original Chinese word is stored in a field called ch, the English translation is stored in a field called en and the pinyin is stored in a field called pi. For piyin always use the the special characters with accents on top and not the numbers behind the character!`
+const repairMessage = `Your response is invalid: %v. Reply with the corrected JSON object only, without any explanation or markdown.`
 
-const sentenceMessage = `Add pinyin to the following sentence written in simplified Chinese. Format the result into a JSON object. The original sentence should be stored in a field called chinese, the English translation should be stored in a field called english and the pinyin should be stored in a field called piniyin. Also split the sentence into words and add JSON array with those words in a field called words. Each word should be a JSON object, the original Chinese word is stored in a field called ch, the English translation is stored in a field called en and the pinyin is stored in a field called pi. For piyin always use the the special characters with accents on top and not the numbers behind the character! Please take extra care, if the input has multiple sentences, do not split them but treat them as asingle sentence. Return a single JSON object only, not a list or array of several ones! Here is the json structure that should be returned:
-type Sentence struct {
-	Chinese string
-	English string
-	Pinyin  string
-	Words   []Word
-}`
-
-const wordExamplesMessage = `Give me three very simple and short Chinese example sentences for the usage of the Chinese word provided by the user. Separate each word in the sentence by a whitespace, this is very important! Use simplified Chinese characters. Also add the pinyin and the english translation. Serialize the response into a JSON object and add the sentences in a JSON array that is referenced by the key "examples". Each example sentence in the array should be a JSON object which has the following fields:
-1. "ch": the example sentence in simplified Chinese (each word separated by a whitespace)
-2. "pi": the piyin for the example sentence
-3. "en": the English translation of the example sentence
-
-Optionally, also add short note to the result if there is anything special to point out on the usage of the word. Maybe there are very similar words which could be confused with the word, or there are common mistakes or misunderstandings that a learner of the Chinese language should be aware of. If the word is frequently used in a certain grammatical context or sentence patterns, please also explain this in the most concise and short manner. Add the note to the response's JSON object in a field called "note". If the note is empty, you do not need to add the field at all. Keep the note as simple and short as possible. Do not add useless information like: "Pay attention to the correct usage of this word in various daily situations." or "Pay attention to the correct order of objects after the word" and the like. We can assume the user always pays attention but wants to know specific details, caveats, casual usages, formal usages, gotchas, common mistakes or hints specific to this word.
-`
-const patternExamplesMessage = `Give me three very simple Chinese example sentences for the usage of the Chinese grammar pattern provided by the user. Segment the sentences by separating each word in the sentence by a whitespace. Use simplified Chinese characters. Also add the pinyin and the english translation. Serialize the response into a JSON dict and add the sentences in a JSON array that is referenced by the key "examples". Each example sentence in the array should be a JSON dict which has the following fields:
-1. "ch": the example sentence in simplified Chinese
-2. "pi": the piyin for the example sentence
-3. "en": the English translation of the example sentence
-
-Optionally, also add short note to the result if there is anything special to point out on the usage of the sentence pattern. Maybe there are very similar patterns which could be confused with the pattern, or there are common mistakes or misunderstandings that a learner of the Chinese language should be aware of. If the pattern is frequently used in a certain grammatical context, please also explain this in the most concise and short manner. Add the note to the response's JSON dict in a field called "note". If the note is empty, you do not need to add the field at all. Keep the note as simpleand short as possible. Do not add useless information like: "Pay attention to the correct usage of this word in various daily situations." or "Pay attention to the correct order of objects after the word" and the like. We can assume the user always pays attention but wants to know specific details, caveats, casual usages, formal usages, gotchas, common mistakes or hints specific to this word.
-`
+// number of retries if the response is invalid
+const maxRetries = 2
+
+// names of the prompts, used to identify canned responses
+const (
+	decomposeDialogPrompt = "decompose_dialog"
+	sentencePrompt        = "sentence"
+	wordExamplesPrompt    = "word_examples"
+	patternExamplesPrompt = "pattern_examples"
+	lookupWordPrompt      = "lookup_word"
+	grammarNotesPrompt    = "grammar_notes"
+	dialoguePrompt        = "dialogue"
+)
+
+// LLM is used by the processors to decompose text and to get example sentences.
+type LLM interface {
+	GetExamplesForPattern(pattern string, v *Vocabulary) (ExampleSentences, error)
+	GetExamplesForWord(word string, v *Vocabulary) (ExampleSentences, error)
+	DecomposeSentence(sentence string) (*Sentence, error)
+	Decompose(dialog string) (*Decomposition, error)
+	LookupWord(word string) (*WordEntry, error)
+	ExplainGrammar(cloze string) (*GrammarNotes, error)
+	GenerateDialogue(words []string, speakers int, v *Vocabulary) (*Dialogue, error)
+}
 
 type Message struct {
 	Role    string `json:"role"`
@@ -44,8 +43,15 @@ type Message struct {
 }
 
 type Request struct {
-	Model    string    `json:"model"`
-	Messages []Message `json:"messages"`
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Temperature float64   `json:"temperature"`
+	// not supported by all models and servers
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+}
+
+type ResponseFormat struct {
+	Type string `json:"type"`
 }
 
 type Word struct {
@@ -63,9 +69,57 @@ type Sentence struct {
 	Chinese string `json:"chinese"`
 	English string `json:"english"`
 	Pinyin  string `json:"pinyin"`
+	Literal string `json:"literal"` // word-by-word translation, empty for decomposed dialogs and responses cached before it was asked for
 	Words   []Word `json:"words"`
 }
 
+// WordEntry is the dictionary entry of a word that is missing from HSK and CEDICT.
+type WordEntry struct {
+	Traditional string   `json:"traditional"`
+	Pinyin      string   `json:"pinyin"`
+	Definitions []string `json:"definitions"`
+	Chars       []Word   `json:"chars"`
+}
+
+// GrammarNotes explain a grammar pattern if the grammar file leaves them out.
+type GrammarNotes struct {
+	Note      string   `json:"note"`
+	Structure string   `json:"structure"`
+	Summary   []string `json:"summary"`
+}
+
+type DialogueLine struct {
+	Speaker string `json:"speaker"`
+	Chinese string `json:"ch"`
+	English string `json:"en"`
+}
+
+type Dialogue struct {
+	Lines []DialogueLine `json:"lines"`
+}
+
+func (d *Dialogue) words() []Word {
+	words := make([]Word, len(d.Lines))
+	for i, l := range d.Lines {
+		words[i] = Word{Ch: l.Chinese, En: l.English}
+	}
+	return words
+}
+
+func (d *Dialogue) setWords(words []Word) {
+	for i := range d.Lines {
+		d.Lines[i].Chinese = words[i].Ch
+	}
+}
+
+func (e *ExampleSentences) words() []Word {
+	return e.Examples
+}
+
+func (e *ExampleSentences) setWords(words []Word) {
+	e.Examples = words
+}
+
 type Decomposition struct {
 	Sentences []Sentence `json:"sentences"`
 }
@@ -83,96 +137,153 @@ type Response struct {
 	ID      string  `json:"id"`
 	Model   string  `json:"model"`
 	Object  string  `json:"object"`
-	Usage   struct {
-		CompletionTokens int `json:"completion_tokens"`
-		PromptTokens     int `json:"prompt_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage   Usage   `json:"usage"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
 }
 
 type Client struct {
-	endpoint  string
-	apiKey    string
-	model     string
+	provider  Provider
 	cache     *Cache
 	segmenter *segment.Segmenter
+	prompts   Prompts
 }
 
-func NewClient(apiKey string, cache *Cache, segmenter *segment.Segmenter) (*Client, error) {
+func NewClient(provider Provider, cache *Cache, segmenter *segment.Segmenter, prompts Prompts) (*Client, error) {
+	if provider == nil {
+		return nil, errors.New("provider must not be nil")
+	}
 	if cache == nil {
 		return nil, errors.New("cache must not be nil")
 	}
+	if prompts == nil {
+		return nil, errors.New("prompts must not be nil")
+	}
 	return &Client{
-		endpoint:  "https://api.openai.com/v1/chat/completions",
-		apiKey:    apiKey,
-		model:     "gpt-3.5-turbo",
+		provider:  provider,
 		cache:     cache,
 		segmenter: segmenter,
+		prompts:   prompts,
 	}, nil
 }
 
-func (c *Client) GetExamplesForPattern(pattern string) (ExampleSentences, error) {
-	content := c.fetch(pattern, patternExamplesMessage, 2)
+// GetExamplesForPattern returns example sentences for a grammar pattern. If v is not
+// nil, the sentences are limited to the known vocabulary.
+func (c *Client) GetExamplesForPattern(pattern string, v *Vocabulary) (ExampleSentences, error) {
+	return fetchSentences[ExampleSentences](c, pattern, patternExamplesPrompt, v)
+}
 
-	var result ExampleSentences
-	err := json.Unmarshal([]byte(content), &result)
+// GetExamplesForWord returns example sentences for a word. If v is not nil, the
+// sentences are limited to the known vocabulary.
+func (c *Client) GetExamplesForWord(word string, v *Vocabulary) (ExampleSentences, error) {
+	return fetchSentences[ExampleSentences](c, word, wordExamplesPrompt, v)
+}
+
+// GenerateDialogue returns a short dialogue between speakers, using the words. If v
+// is not nil, the dialogue is limited to the known vocabulary.
+func (c *Client) GenerateDialogue(words []string, speakers int, v *Vocabulary) (*Dialogue, error) {
+	query := fmt.Sprintf("speakers: %d\nwords: %s", speakers, strings.Join(words, ", "))
+	d, err := fetchSentences[Dialogue](c, query, dialoguePrompt, v)
 	if err != nil {
-		return result, fmt.Errorf("Error parsing JSON for example sentences input %s: %v", content, err)
+		return nil, err
 	}
+	return &d, nil
+}
+
+// sentences are responses whose sentences are segmented and checked against the vocabulary.
+type sentences interface {
+	schema
+	words() []Word
+	setWords([]Word)
+}
 
-	// segment chinese text
-	examples, err := c.segmentExamples(result.Examples)
+// fetchSentences fetches and segments the sentences. Sentences with too many unknown
+// words are sent back to the model to be replaced, up to maxRetries times.
+func fetchSentences[T any, PT interface {
+	*T
+	sentences
+}](c *Client, query, promptID string, v *Vocabulary) (T, error) {
+	var result T
+	key, completion := c.request(query, promptID, v)
+	content, err := c.fetch(key, completion, PT(&result))
 	if err != nil {
-		slog.Error("Segment word example sentences", "pattern", pattern, "error", err)
+		return result, err
 	}
-	result.Examples = examples
+	PT(&result).setWords(c.segment(query, PT(&result).words()))
+	if v == nil {
+		return result, nil
+	}
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		rejected := v.check(query, PT(&result).words())
+		if len(rejected) == 0 {
+			return result, nil
+		}
+		slog.Info("regenerate sentences with unknown words", "query", query, "rejected", len(rejected), "attempt", attempt+1)
 
+		completion.History = []Message{
+			{Role: "assistant", Content: content},
+			{Role: "user", Content: v.regenerateMessage(rejected)},
+		}
+		var regenerated T
+		answer, err := c.complete(completion, PT(&regenerated))
+		if err != nil {
+			slog.Warn("regenerate sentences", "query", query, "error", err)
+			return result, nil
+		}
+		content = answer.Content
+		c.store(key, answer)
+		PT(&regenerated).setWords(c.segment(query, PT(&regenerated).words()))
+		result = regenerated
+	}
+	if rejected := v.check(query, PT(&result).words()); len(rejected) > 0 {
+		slog.Warn("sentences contain unknown words", "query", query, "rejected", len(rejected))
+	}
 	return result, nil
 }
 
-func (c *Client) GetExamplesForWord(word string) (ExampleSentences, error) {
-	content := c.fetch(word, wordExamplesMessage, 2)
-
-	var result ExampleSentences
-	err := json.Unmarshal([]byte(content), &result)
+func (c *Client) segment(query string, examples []Word) []Word {
+	segmented, err := c.segmentExamples(examples)
 	if err != nil {
-		return result, fmt.Errorf("Error parsing JSON for example sentences input %s: %v", content, err)
+		slog.Error("Segment example sentences", "query", query, "error", err)
 	}
-	examples, err := c.segmentExamples(result.Examples)
-	if err != nil {
-		slog.Error("Segment word example sentences", "word", word, "error", err)
-	}
-	result.Examples = examples
-	return result, nil
+	return segmented
 }
 
 func (c *Client) DecomposeSentence(sentence string) (*Sentence, error) {
-	content := c.fetch(sentence, sentenceMessage, 2)
 	var result Sentence
-	err := json.Unmarshal([]byte(content), &result)
-	if err != nil {
-		return nil, fmt.Errorf("Error parsing JSON for sentences input %s: %v", content, err)
+	if err := c.lookup(sentence, sentencePrompt, &result); err != nil {
+		return nil, err
 	}
 	return &result, nil
 }
 
-func (c *Client) Decompose(dialog string) (*Decomposition, error) {
-	content := c.fetch(dialog, decomposeDialogMessage, 2)
+// LookupWord is the fallback for words that are in none of the dictionaries, e.g. slang or names.
+func (c *Client) LookupWord(word string) (*WordEntry, error) {
+	var result WordEntry
+	if err := c.lookup(word, lookupWordPrompt, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
 
-	var sentences []Sentence
-	if strings.Contains(content, "\"sentences\": [") {
-		var decomp Decomposition
-		err := json.Unmarshal([]byte(content), &decomp)
-		if err != nil {
-			return nil, fmt.Errorf("Error parsing JSON sentences for dialog input %s: %v", content, err)
-		}
-		sentences = decomp.Sentences
-	} else {
-		err := json.Unmarshal([]byte(content), &sentences)
-		if err != nil {
-			log.Printf("Error parsing JSON for dialog input %s: %v", content, err)
-		}
+// ExplainGrammar returns the note, structure and summary of the grammar pattern that
+// is marked with parentheses in the cloze sentence.
+func (c *Client) ExplainGrammar(cloze string) (*GrammarNotes, error) {
+	var result GrammarNotes
+	if err := c.lookup(cloze, grammarNotesPrompt, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) Decompose(dialog string) (*Decomposition, error) {
+	var decomp Decomposition
+	if err := c.lookup(dialog, decomposeDialogPrompt, &decomp); err != nil {
+		return nil, err
 	}
+	sentences := decomp.Sentences
 
 	// segment sentences
 	words := make([]Word, len(sentences))
@@ -194,87 +305,122 @@ func (c *Client) Decompose(dialog string) (*Decomposition, error) {
 	}, nil
 }
 
-// FIXME: use filename for cloze cache lookup
-// implements a very simple retry. openai api sometimes fails to deliver a result or returns a invalid json
-// sub-sequent requests might succeed so we naively just try `retryCount` times.
-func (c *Client) fetch(query, message string, retryCount int) string {
-	if retryCount == -1 {
-		log.Fatalf("excceded retries for query: %s\n", query)
-	}
-	slog.Info("lookup", "query", query)
-
-	if content, ok := c.cache.Lookup(query); ok {
-		slog.Debug("found in cache", "file", query)
-		return content
-	}
-	slog.Debug("not found in cache", "file", query)
-
-	messages := []Message{
-		{
-			Role:    "system",
-			Content: message,
-		},
-		{
-			Role:    "user",
-			Content: query,
-		},
+// request returns the cache key and the completion for a query. Constrained requests
+// are cached separately from unconstrained ones.
+func (c *Client) request(query, promptID string, v *Vocabulary) (Key, Completion) {
+	p := c.prompts[promptID]
+	key := Key{
+		Prompt:  promptID,
+		Version: p.version,
+		Model:   c.provider.Model(),
+		Query:   query,
 	}
-	payload := Request{
-		Model:    c.model,
-		Messages: messages,
+	completion := Completion{
+		Prompt: promptID,
+		System: p.message,
+		User:   query,
+		JSON:   true,
 	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		fmt.Printf("error marshalling JSON payload: %v", err)
-		fmt.Println("retry...")
-		return c.fetch(query, message, retryCount-1)
+	if v != nil {
+		key.Variant = v.variant()
+		if instructions := v.instructions(); instructions != "" {
+			completion.System += "\n" + instructions
+		}
 	}
+	return key, completion
+}
 
-	// Set up the request object
-	req, err := http.NewRequest("POST", c.endpoint, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		fmt.Printf("error creating request: %v", err)
-		fmt.Println("retry...")
-		return c.fetch(query, message, retryCount-1)
-	}
+// lookup decodes the response for the query into out. The response is looked up in
+// the cache first.
+func (c *Client) lookup(query, promptID string, out schema) error {
+	key, completion := c.request(query, promptID, nil)
+	_, err := c.fetch(key, completion, out)
+	return err
+}
 
-	// Set the request headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+// fetch decodes the cached or fetched response into out and returns its content.
+// Only valid responses are cached.
+func (c *Client) fetch(key Key, completion Completion, out schema) (string, error) {
+	slog.Info("lookup", "query", key.Query)
 
-	// Send the request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("error sending request: %v", err)
-		fmt.Println("retry...")
-		return c.fetch(query, message, retryCount-1)
+	if e, ok := c.cache.Lookup(key); ok {
+		err := decode(e.Response, out)
+		if err == nil {
+			slog.Debug("found in cache", "prompt", key.Prompt, "query", key.Query)
+			return e.Response, nil
+		}
+		slog.Warn("invalid response in cache, fetching again", "prompt", key.Prompt, "query", key.Query, "error", err)
+	} else {
+		slog.Debug("not found in cache", "prompt", key.Prompt, "query", key.Query)
 	}
-	defer resp.Body.Close()
 
-	// Read the response body
-	// var result map[string]interface{}
-	var result Response
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	result, err := c.complete(completion, out)
 	if err != nil {
-		fmt.Printf("error decoding JSON response: %v\n", err)
-		fmt.Println("retry...")
-		return c.fetch(query, message, retryCount-1)
+		return "", err
 	}
+	c.store(key, result)
+	return result.Content, nil
+}
 
-	if len(result.Choices) == 0 {
-		fmt.Println("no result, retry...")
-		return c.fetch(query, message, retryCount-1)
+// complete decodes the model's answer to the completion into out. The openai api
+// sometimes fails to deliver a result or returns invalid json. Invalid responses are
+// retried up to maxRetries times, the validation error is sent back to the model so
+// it can repair its answer. The returned usage includes all attempts.
+func (c *Client) complete(completion Completion, out schema) (Result, error) {
+	var usage Usage
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			slog.Warn("retry", "query", completion.User, "attempt", attempt, "error", lastErr)
+		}
+		result, err := c.provider.Complete(completion)
+		if err != nil {
+			// the provider retries transient errors itself
+			return Result{}, &ResponseError{
+				Prompt:   completion.Prompt,
+				Query:    completion.User,
+				Attempts: attempt + 1,
+				Err:      err,
+			}
+		}
+		// failed attempts are paid for too
+		usage.add(result.Usage)
+		if err := decode(result.Content, out); err != nil {
+			lastErr = err
+			// let the model repair its answer
+			completion.History = append(completion.History,
+				Message{Role: "assistant", Content: result.Content},
+				Message{Role: "user", Content: fmt.Sprintf(repairMessage, err)},
+			)
+			continue
+		}
+		return Result{
+			Content: stripCodeFence(result.Content),
+			Usage:   usage,
+		}, nil
 	}
+	return Result{}, &ResponseError{
+		Prompt:   completion.Prompt,
+		Query:    completion.User,
+		Attempts: maxRetries + 1,
+		Err:      lastErr,
+	}
+}
 
-	content := strings.TrimPrefix(result.Choices[0].Message.Content, "```")
-	content = strings.TrimPrefix(result.Choices[0].Message.Content, "json")
-	content = strings.TrimSuffix(content, "```")
-
-	c.cache.Add(query, content)
-
-	return content
+func (c *Client) store(key Key, result Result) {
+	entry := Entry{
+		Prompt:   key.Prompt,
+		Version:  key.Version,
+		Model:    key.Model,
+		Query:    key.Query,
+		Variant:  key.Variant,
+		Created:  time.Now().UTC(),
+		Usage:    result.Usage,
+		Response: result.Content,
+	}
+	if err := c.cache.Add(entry); err != nil {
+		slog.Error("add to cache", "query", key.Query, "error", err)
+	}
 }
 
 func (c *Client) segmentExamples(in []Word) ([]Word, error) {
@@ -287,7 +433,8 @@ func (c *Client) segmentExamples(in []Word) ([]Word, error) {
 		}
 	}
 
-	if len(examples) > 0 {
+	// the model is asked to separate the words by whitespace, which is used without a segmenter
+	if len(examples) > 0 && c.segmenter != nil {
 		var err error
 		examples, err = c.segmenter.SegmentChinese(examples)
 		if err != nil {
@@ -0,0 +1,286 @@
+package openai
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// scripted returns the responses in order and records the completions
+type scripted struct {
+	responses   []string
+	completions []Completion
+}
+
+func (s *scripted) Model() string {
+	return "scripted"
+}
+
+func (s *scripted) Complete(c Completion) (Result, error) {
+	s.completions = append(s.completions, c)
+	if len(s.responses) == 0 {
+		return Result{}, errors.New("no more responses")
+	}
+	r := s.responses[0]
+	s.responses = s.responses[1:]
+	return Result{Content: r, Usage: Usage{PromptTokens: 10, TotalTokens: 10}}, nil
+}
+
+func loadTestPrompts(t *testing.T) Prompts {
+	prompts, err := LoadPrompts(DefaultPromptVars)
+	if err != nil {
+		t.Fatalf("LoadPrompts returned an error: %v", err)
+	}
+	return prompts
+}
+
+func sentenceKey(t *testing.T, query string) Key {
+	return Key{Prompt: sentencePrompt, Version: loadTestPrompts(t)[sentencePrompt].version, Model: "scripted", Query: query}
+}
+
+func TestFake(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, sentencePrompt), os.ModePerm); err != nil {
+		t.Fatalf("Failed to create prompt dir: %v", err)
+	}
+	canned := `{"chinese":"你好","english":"hello","pinyin":"nǐ hǎo","words":[{"ch":"你好","en":"hello","pi":"nǐ hǎo"}]}`
+	if err := os.WriteFile(filepath.Join(dir, sentencePrompt, "你好.json"), []byte(canned), 0644); err != nil {
+		t.Fatalf("Failed to write canned response: %v", err)
+	}
+
+	client, err := NewClient(&Fake{Dir: dir}, NewCache(t.TempDir()), nil, loadTestPrompts(t))
+	if err != nil {
+		t.Fatalf("NewClient returned an error: %v", err)
+	}
+	s, err := client.DecomposeSentence("你 好")
+	if err != nil {
+		t.Fatalf("DecomposeSentence returned an error: %v", err)
+	}
+	if s.English != "hello" || len(s.Words) != 1 {
+		t.Errorf("Unexpected sentence: %+v", s)
+	}
+
+	if _, err := (&Fake{Dir: dir}).Complete(Completion{Prompt: wordExamplesPrompt, User: "你好"}); err == nil {
+		t.Errorf("Expected an error for a missing canned response")
+	}
+}
+
+func TestFetchRepair(t *testing.T) {
+	provider := &scripted{responses: []string{
+		`{"chinese":"你好","english":"hello"`,
+		`{"chinese":"你好","english":"hello","pinyin":"nǐ hǎo","words":[]}`,
+		"```json\n{\"chinese\":\"你好\",\"english\":\"hello\",\"pinyin\":\"nǐ hǎo\",\"words\":[{\"ch\":\"你好\",\"en\":\"hello\",\"pi\":\"nǐ hǎo\"}]}\n```",
+	}}
+	cache := NewCache(t.TempDir())
+	client, err := NewClient(provider, cache, nil, loadTestPrompts(t))
+	if err != nil {
+		t.Fatalf("NewClient returned an error: %v", err)
+	}
+
+	s, err := client.DecomposeSentence("你好")
+	if err != nil {
+		t.Fatalf("DecomposeSentence returned an error: %v", err)
+	}
+	if s.Pinyin != "nǐ hǎo" {
+		t.Errorf("Unexpected sentence: %+v", s)
+	}
+	// the validation error of the second response is sent back to the model
+	last := provider.completions[2].History
+	if len(last) != 4 || !strings.Contains(last[3].Content, "field words: must not be empty") {
+		t.Errorf("Expected validation errors in history, got: %+v", last)
+	}
+	e, ok := cache.Lookup(sentenceKey(t, "你 好"))
+	if !ok || strings.HasPrefix(e.Response, "```") {
+		t.Errorf("Expected valid response without code fence in cache, got: %q", e.Response)
+	}
+	// all attempts are accounted for
+	if e.Usage.TotalTokens != 30 {
+		t.Errorf("Expected usage of 3 attempts, got: %+v", e.Usage)
+	}
+
+	// invalid responses are not cached and the error is returned
+	provider.responses = []string{"{}", "{}", "{}"}
+	_, err = client.DecomposeSentence("再见")
+	var respErr *ResponseError
+	if !errors.As(err, &respErr) || respErr.Attempts != maxRetries+1 {
+		t.Fatalf("Expected response error, got: %v", err)
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("Expected validation error, got: %v", err)
+	}
+	if _, ok := cache.Lookup(sentenceKey(t, "再见")); ok {
+		t.Errorf("Expected invalid response not to be cached")
+	}
+}
+
+func TestDecomposition(t *testing.T) {
+	var d Decomposition
+	if err := decode(`[{"chinese":"好","english":"good","pinyin":"hǎo","words":[{"ch":"好","en":"good","pi":"hǎo"}]}]`, &d); err != nil {
+		t.Fatalf("Expected bare array to be decoded, got: %v", err)
+	}
+	if len(d.Sentences) != 1 {
+		t.Errorf("Unexpected decomposition: %+v", d)
+	}
+}
+
+func TestLookupWord(t *testing.T) {
+	provider := &scripted{responses: []string{
+		`{"traditional":"內卷","pinyin":"nèijuǎn","definitions":[]}`,
+		`{"traditional":"內卷","pinyin":"nèijuǎn","definitions":["involution","rat race"],"chars":[{"ch":"内","pi":"nèi","en":"inside"},{"ch":"卷","pi":"juǎn","en":"to roll"}]}`,
+	}}
+	cache := NewCache(t.TempDir())
+	client, err := NewClient(provider, cache, nil, loadTestPrompts(t))
+	if err != nil {
+		t.Fatalf("NewClient returned an error: %v", err)
+	}
+	e, err := client.LookupWord("内卷")
+	if err != nil {
+		t.Fatalf("LookupWord returned an error: %v", err)
+	}
+	if e.Pinyin != "nèijuǎn" || len(e.Definitions) != 2 || len(e.Chars) != 2 {
+		t.Errorf("Unexpected word entry: %+v", e)
+	}
+	// the second lookup is served from the cache
+	if _, err := client.LookupWord("内卷"); err != nil || len(provider.completions) != 2 {
+		t.Errorf("Expected cached word entry, got %d completions, error: %v", len(provider.completions), err)
+	}
+}
+
+func TestExamplesVocabulary(t *testing.T) {
+	provider := &scripted{responses: []string{
+		`{"examples":[{"ch":"我 喜欢 苹果 。","pi":"wǒ xǐhuan píngguǒ.","en":"I like apples."},{"ch":"他 每天 锻炼 身体 。","pi":"tā měitiān duànliàn shēntǐ.","en":"He exercises every day."}]}`,
+		`{"examples":[{"ch":"我 喜欢 苹果 。","pi":"wǒ xǐhuan píngguǒ.","en":"I like apples."},{"ch":"他 喜欢 苹果 。","pi":"tā xǐhuan píngguǒ.","en":"He likes apples."}]}`,
+	}}
+	cache := NewCache(t.TempDir())
+	client, err := NewClient(provider, cache, nil, loadTestPrompts(t))
+	if err != nil {
+		t.Fatalf("NewClient returned an error: %v", err)
+	}
+	v := &Vocabulary{
+		Known:      map[string]struct{}{"我": {}, "他": {}, "喜欢": {}},
+		MaxUnknown: 1,
+	}
+	result, err := client.GetExamplesForWord("苹果", v)
+	if err != nil {
+		t.Fatalf("GetExamplesForWord returned an error: %v", err)
+	}
+	if len(provider.completions) != 2 || result.Examples[1].Ch != "他 喜欢 苹果 。" {
+		t.Fatalf("Expected the sentence with unknown words to be regenerated, got: %+v", result.Examples)
+	}
+	if !strings.Contains(provider.completions[0].System, "喜欢, 他, 我") {
+		t.Errorf("Expected the known words in the prompt, got: %s", provider.completions[0].System)
+	}
+	if !strings.Contains(provider.completions[1].History[1].Content, "每天, 锻炼, 身体") {
+		t.Errorf("Expected the unknown words to be sent back, got: %s", provider.completions[1].History[1].Content)
+	}
+	// the regenerated sentences are cached for this variant only
+	key := Key{Prompt: wordExamplesPrompt, Version: loadTestPrompts(t)[wordExamplesPrompt].version, Model: "scripted", Query: "苹果", Variant: v.variant()}
+	if e, ok := cache.Lookup(key); !ok || strings.Contains(e.Response, "锻炼") {
+		t.Errorf("Expected regenerated sentences in cache, got: %+v", e)
+	}
+	if _, ok := cache.Lookup(Key{Prompt: key.Prompt, Version: key.Version, Model: key.Model, Query: key.Query}); ok {
+		t.Errorf("Expected unconstrained key not to be cached")
+	}
+}
+
+func TestLoadPrompts(t *testing.T) {
+	prompts := loadTestPrompts(t)
+	if p := prompts[sentencePrompt]; p.version != "2" || strings.HasPrefix(p.message, "{{") || !strings.Contains(p.message, "called pinyin") {
+		t.Errorf("Unexpected default prompt: %+v", p)
+	}
+
+	vars := DefaultPromptVars
+	vars.HSKLevel = 3
+	custom, err := LoadPrompts(vars)
+	if err != nil {
+		t.Fatalf("LoadPrompts returned an error: %v", err)
+	}
+	if p := custom[wordExamplesPrompt]; !strings.Contains(p.message, "HSK level 3") || !strings.HasPrefix(p.version, "1-") {
+		t.Errorf("Unexpected prompt with custom vars: %+v", p)
+	}
+
+	deck := t.TempDir()
+	override := "{{/* version: 1 */}}\nTranslate to {{.Language}}."
+	if err := os.WriteFile(filepath.Join(deck, sentencePrompt+".tmpl"), []byte(override), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	overridden, err := LoadPrompts(DefaultPromptVars, deck, filepath.Join(deck, "missing"))
+	if err != nil {
+		t.Fatalf("LoadPrompts returned an error: %v", err)
+	}
+	if p := overridden[sentencePrompt]; p.message != "Translate to English." || p.version == "1" {
+		t.Errorf("Unexpected overridden prompt: %+v", p)
+	}
+	if overridden[wordExamplesPrompt] != prompts[wordExamplesPrompt] {
+		t.Errorf("Expected prompts without override to be unchanged")
+	}
+
+	if err := os.WriteFile(filepath.Join(deck, sentencePrompt+".tmpl"), []byte("no version"), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	if _, err := LoadPrompts(DefaultPromptVars, deck); err == nil {
+		t.Errorf("Expected an error for a template without version")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	word := Key{Prompt: wordExamplesPrompt, Version: "1", Model: "gpt-3.5-turbo", Query: "你好"}
+	sentence := Key{Prompt: sentencePrompt, Version: "1", Model: "gpt-3.5-turbo", Query: "你好"}
+	if word.Hash() == sentence.Hash() {
+		t.Errorf("Expected different hashes for different prompts")
+	}
+	changed := word
+	changed.Version = "2"
+	if word.Hash() == changed.Hash() {
+		t.Errorf("Expected different hashes for different prompt versions")
+	}
+	spaced := word
+	spaced.Query = " 你 好\n"
+	if word.Hash() != spaced.Hash() {
+		t.Errorf("Expected whitespace to be ignored")
+	}
+}
+
+func TestMigrateLegacyCache(t *testing.T) {
+	src := t.TempDir()
+	legacy := map[string]string{
+		"你好.yaml":       `{"examples":[{"ch":"你 好","en":"hello","pi":"nǐ hǎo"}]}`,
+		"一…就….yaml":     `{"examples":[{"ch":"我 一 到 就 睡觉","en":"I sleep as soon as I arrive","pi":"wǒ yí dào jiù shuìjiào"}]}`,
+		"我很好。.yaml":     "```json\n" + `{"chinese":"我很好。","english":"I am fine.","pinyin":"wǒ hěn hǎo.","words":[]}` + "\n```",
+		"你好吗？我很好。.yaml": `[{"chinese":"你好吗？","english":"How are you?","pinyin":"nǐ hǎo ma?","words":[]}]`,
+	}
+	for name, content := range legacy {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write legacy file: %v", err)
+		}
+	}
+
+	cache := NewCache(t.TempDir())
+	prompts := loadTestPrompts(t)
+	n, err := MigrateLegacyCache(src, cache, prompts, DefaultModel)
+	if err != nil {
+		t.Fatalf("MigrateLegacyCache returned an error: %v", err)
+	}
+	if n != len(legacy) {
+		t.Errorf("Expected %d migrated entries, got: %d", len(legacy), n)
+	}
+	for prompt, query := range map[string]string{
+		wordExamplesPrompt:    "你好",
+		patternExamplesPrompt: "一…就…",
+		sentencePrompt:        "我很好。",
+		decomposeDialogPrompt: "你好吗？我很好。",
+	} {
+		key := Key{Prompt: prompt, Version: prompts[prompt].version, Model: DefaultModel, Query: query}
+		e, ok := cache.Lookup(key)
+		if !ok {
+			t.Errorf("Expected %s to be migrated for prompt %s", query, prompt)
+			continue
+		}
+		if strings.HasPrefix(e.Response, "```") {
+			t.Errorf("Expected code fence to be stripped: %s", e.Response)
+		}
+	}
+}
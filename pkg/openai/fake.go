@@ -0,0 +1,39 @@
+package openai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the response used by Fake if there is no file for a query
+const fakeDefault = "default"
+
+// Fake serves canned responses from files for tests and offline runs. Responses are
+// looked up in <Dir>/<prompt>/<query>.json, where whitespace is removed from the
+// query, and fall back to <Dir>/<prompt>/default.json.
+type Fake struct {
+	Dir string
+}
+
+func (f *Fake) Model() string {
+	return "fake"
+}
+
+func (f *Fake) Complete(c Completion) (Result, error) {
+	for _, name := range []string{fakeFilename(c.User), fakeDefault} {
+		b, err := os.ReadFile(filepath.Join(f.Dir, c.Prompt, name+".json"))
+		if err == nil {
+			return Result{Content: string(b)}, nil
+		}
+		if !os.IsNotExist(err) {
+			return Result{}, err
+		}
+	}
+	return Result{}, fmt.Errorf("no canned response for prompt %s and query %s in %s", c.Prompt, c.User, f.Dir)
+}
+
+func fakeFilename(query string) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(query, "/", "")), "")
+}
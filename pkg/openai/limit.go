@@ -0,0 +1,117 @@
+package openai
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// tokens reserved for the answer until the actual usage is known
+const completionTokensEstimate = 500
+
+// RateLimited limits the requests and tokens per minute of a provider, which are
+// shared by all workers. Waiting requests return once the context is done.
+type RateLimited struct {
+	ctx      context.Context
+	provider Provider
+	rpm      int // 0 means unlimited
+	tpm      int // 0 means unlimited
+
+	mu     sync.Mutex
+	events []*event // requests of the last minute
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+type event struct {
+	at     time.Time
+	tokens int
+}
+
+func NewRateLimited(ctx context.Context, provider Provider, rpm, tpm int) *RateLimited {
+	return &RateLimited{
+		ctx:      ctx,
+		provider: provider,
+		rpm:      rpm,
+		tpm:      tpm,
+		now:      time.Now,
+		sleep: func(d time.Duration) {
+			select {
+			case <-ctx.Done():
+			case <-time.After(d):
+			}
+		},
+	}
+}
+
+func (r *RateLimited) Model() string {
+	return r.provider.Model()
+}
+
+func (r *RateLimited) Complete(c Completion) (Result, error) {
+	e, err := r.reserve(estimateTokens(c))
+	if err != nil {
+		return Result{}, err
+	}
+	result, err := r.provider.Complete(c)
+	if result.Usage.TotalTokens > 0 {
+		r.mu.Lock()
+		e.tokens = result.Usage.TotalTokens
+		r.mu.Unlock()
+	}
+	return result, err
+}
+
+// reserve blocks until the request fits into the limits of the last minute or the
+// context is done.
+func (r *RateLimited) reserve(tokens int) (*event, error) {
+	for {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		now := r.now()
+		r.prune(now)
+		used := 0
+		for _, e := range r.events {
+			used += e.tokens
+		}
+		// a single request that exceeds the token limit is sent once the window is empty
+		fitsRequests := r.rpm <= 0 || len(r.events) < r.rpm
+		fitsTokens := r.tpm <= 0 || used+tokens <= r.tpm || len(r.events) == 0
+		if fitsRequests && fitsTokens {
+			e := &event{at: now, tokens: tokens}
+			r.events = append(r.events, e)
+			r.mu.Unlock()
+			return e, nil
+		}
+		wait := r.events[0].at.Add(time.Minute).Sub(now)
+		r.mu.Unlock()
+		r.sleep(wait)
+	}
+}
+
+func (r *RateLimited) prune(now time.Time) {
+	i := 0
+	for i < len(r.events) && !now.Before(r.events[i].at.Add(time.Minute)) {
+		i++
+	}
+	r.events = r.events[i:]
+}
+
+// estimateTokens is a rough estimate: about 4 ascii characters or 1 hanzi per token.
+func estimateTokens(c Completion) int {
+	text := c.System + c.User
+	for _, m := range c.History {
+		text += m.Content
+	}
+	ascii := 0
+	for i := 0; i < len(text); i++ {
+		if text[i] < utf8.RuneSelf {
+			ascii++
+		}
+	}
+	other := utf8.RuneCountInString(text) - ascii
+	return ascii/4 + other + completionTokensEstimate
+}
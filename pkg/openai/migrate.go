@@ -0,0 +1,102 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MigrateLegacyCache imports the flat cache files in src, named after the query without
+// whitespace, into the cache. The old files do not store the prompt, so it is inferred
+// from the response. All old responses were fetched with the same model. Returns the
+// number of imported entries.
+//
+// Entries get the current version of their prompt in prompts, otherwise they would
+// never be hit. The fields added to the prompts since are optional or accepted in the
+// old format, e.g. bare arrays of sentences. Cached responses are validated on lookup,
+// invalid ones are fetched again.
+func MigrateLegacyCache(src string, dst *Cache, prompts Prompts, model string) (int, error) {
+	files, err := os.ReadDir(src)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".yaml" {
+			continue
+		}
+		path := filepath.Join(src, file.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return count, err
+		}
+		info, err := file.Info()
+		if err != nil {
+			return count, err
+		}
+		query := strings.TrimSuffix(file.Name(), ".yaml")
+		response := stripCodeFence(string(b))
+		promptID, err := inferPrompt(query, response)
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", path, err)
+		}
+		p, ok := prompts[promptID]
+		if !ok {
+			return count, fmt.Errorf("%s: no prompt %s", path, promptID)
+		}
+		err = dst.Add(Entry{
+			Prompt:   promptID,
+			Version:  p.version,
+			Model:    model,
+			Query:    query,
+			Created:  info.ModTime().UTC().Truncate(time.Second),
+			Response: response,
+		})
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// inferPrompt guesses the prompt of a legacy response from its fields. Example sentences
+// for words and grammar patterns have the same structure, patterns are told apart by
+// their placeholders, e.g. V + 得 + Adj or 一…就….
+func inferPrompt(query, response string) (string, error) {
+	if strings.HasPrefix(response, "[") {
+		return decomposeDialogPrompt, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(response), &fields); err != nil {
+		return "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	switch {
+	case fields["sentences"] != nil:
+		return decomposeDialogPrompt, nil
+	case fields["examples"] != nil:
+		if isPattern(query) {
+			return patternExamplesPrompt, nil
+		}
+		return wordExamplesPrompt, nil
+	case fields["chinese"] != nil:
+		return sentencePrompt, nil
+	}
+	return "", fmt.Errorf("unknown response structure")
+}
+
+func isPattern(query string) bool {
+	if strings.ContainsAny(query, "+…~") || strings.Contains(query, "...") {
+		return true
+	}
+	for _, r := range query {
+		if r < unicode.MaxASCII && unicode.IsLetter(r) {
+			return true
+		}
+	}
+	return false
+}
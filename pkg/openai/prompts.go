@@ -0,0 +1,106 @@
+package openai
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/fbngrm/zh-anki/pkg/template"
+)
+
+// defaultPrompts contains a template for each prompt, named after the prompt, e.g.
+// word_examples.tmpl. The first line of a template declares its version, e.g.
+// {{/* version: 2 */}}. Increase the version when a change should invalidate cached
+// responses. The templates are embedded, so commands run from any dir.
+//
+//go:embed prompts/*.tmpl
+var defaultPrompts embed.FS
+
+var versionRe = regexp.MustCompile(`{{/\*\s*version:\s*(\S+)\s*\*/}}`)
+
+// PromptVars are the variables of the prompt templates.
+type PromptVars struct {
+	Language string // of translations and explanations
+	HSKLevel int    // target level of generated sentences, 0 means no level
+	Examples int    // number of example sentences
+}
+
+var DefaultPromptVars = PromptVars{
+	Language: "English",
+	Examples: 3,
+}
+
+type prompt struct {
+	message string
+	// part of the cache key
+	version string
+}
+
+// Prompts are rendered once per run, keyed by the name of the prompt.
+type Prompts map[string]prompt
+
+// LoadPrompts renders the templates of all prompts. Templates in the override dirs
+// replace the defaults, later dirs win, e.g. data/<deck>/prompts. Missing override
+// dirs are skipped.
+//
+// Cached responses of the default templates are keyed by the version only. Overrides
+// and custom variables add a hash of the rendered prompt to the version, so they
+// don't share cached responses with the defaults.
+func LoadPrompts(vars PromptVars, overrideDirs ...string) (Prompts, error) {
+	defaults, err := fs.Sub(defaultPrompts, "prompts")
+	if err != nil {
+		return nil, err
+	}
+	prompts := make(Prompts)
+	for _, name := range []string{
+		decomposeDialogPrompt,
+		sentencePrompt,
+		wordExamplesPrompt,
+		patternExamplesPrompt,
+		lookupWordPrompt,
+		grammarNotesPrompt,
+		dialoguePrompt,
+	} {
+		fsys, source := defaults, "default"
+		for _, d := range overrideDirs {
+			if _, err := os.Stat(filepath.Join(d, name+".tmpl")); err == nil {
+				fsys, source = os.DirFS(d), d
+			}
+		}
+		p, err := loadPrompt(fsys, name, vars)
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s (%s): %w", name, source, err)
+		}
+		if source != "default" || vars != DefaultPromptVars {
+			h := sha256.Sum256([]byte(p.message))
+			p.version += "-" + hex.EncodeToString(h[:])[:8]
+		}
+		prompts[name] = p
+	}
+	return prompts, nil
+}
+
+func loadPrompt(fsys fs.FS, name string, vars PromptVars) (prompt, error) {
+	b, err := fs.ReadFile(fsys, name+".tmpl")
+	if err != nil {
+		return prompt{}, err
+	}
+	m := versionRe.FindSubmatch(b)
+	if m == nil {
+		return prompt{}, fmt.Errorf("missing version in template %s.tmpl", name)
+	}
+	message, err := template.NewFSProcessor(fsys, name+".tmpl").Fill(vars, name+".tmpl")
+	if err != nil {
+		return prompt{}, err
+	}
+	return prompt{
+		message: strings.Trim(message, "\r\n"),
+		version: string(m[1]),
+	}, nil
+}
@@ -0,0 +1,190 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fbngrm/zh-anki/pkg/retry"
+)
+
+const DefaultBaseURL = "https://api.openai.com/v1"
+const DefaultModel = "gpt-3.5-turbo"
+
+// Completion is a single request to a language model.
+type Completion struct {
+	Prompt string // name of the prompt, e.g. word_examples
+	System string // the prompt itself
+	User   string // the query
+	// previous answers and corrections, sent after the query
+	History []Message
+	// request a JSON object if the provider supports it
+	JSON bool
+}
+
+// Result is the answer of the model to a completion.
+type Result struct {
+	Content string
+	Usage   Usage
+}
+
+// Provider returns the model's answer to a completion.
+type Provider interface {
+	Complete(c Completion) (Result, error)
+	// Model is part of the cache key
+	Model() string
+}
+
+type Config struct {
+	BaseURL     string // e.g. https://api.openai.com/v1 or http://localhost:8080/v1 for local servers
+	APIKey      string
+	Model       string
+	Temperature float64
+	Timeout     time.Duration
+	// request JSON objects via response_format, not all local servers support this
+	JSONMode bool
+	// backoff for rate limits and server errors, defaults to retry.Default
+	Backoff *retry.Backoff
+}
+
+// OpenAICompatible talks to any server implementing the OpenAI chat completions API.
+// Requests are canceled once the context is done, e.g. on interrupt.
+type OpenAICompatible struct {
+	ctx         context.Context
+	endpoint    string
+	apiKey      string
+	model       string
+	temperature float64
+	jsonMode    bool
+	backoff     retry.Backoff
+	httpClient  *http.Client
+}
+
+func NewOpenAICompatible(ctx context.Context, cfg Config) *OpenAICompatible {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.Model == "" {
+		cfg.Model = DefaultModel
+	}
+	backoff := retry.Default
+	if cfg.Backoff != nil {
+		backoff = *cfg.Backoff
+	}
+	return &OpenAICompatible{
+		ctx:         ctx,
+		endpoint:    strings.TrimSuffix(cfg.BaseURL, "/") + "/chat/completions",
+		apiKey:      cfg.APIKey,
+		model:       cfg.Model,
+		temperature: cfg.Temperature,
+		jsonMode:    cfg.JSONMode,
+		backoff:     backoff,
+		httpClient:  &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (o *OpenAICompatible) Model() string {
+	return o.model
+}
+
+func (o *OpenAICompatible) Complete(c Completion) (Result, error) {
+	messages := []Message{
+		{
+			Role:    "system",
+			Content: c.System,
+		},
+		{
+			Role:    "user",
+			Content: c.User,
+		},
+	}
+	payload := Request{
+		Model:       o.model,
+		Messages:    append(messages, c.History...),
+		Temperature: o.temperature,
+	}
+	if c.JSON && o.jsonMode {
+		payload.ResponseFormat = &ResponseFormat{Type: "json_object"}
+	}
+	jsonPayload, err := json.Marshal(payload)
+	if err != nil {
+		return Result{}, fmt.Errorf("marshal payload: %w", err)
+	}
+
+	// rate limits and server errors are retried, other errors are returned immediately
+	var content Result
+	err = o.backoff.Do(o.ctx, func() error {
+		var err error
+		content, err = o.send(jsonPayload)
+		return err
+	})
+	return content, err
+}
+
+// StatusError is returned for responses with a status other than 200.
+type StatusError struct {
+	Code    int
+	Message string
+	// parsed from the Retry-After header of 429 responses
+	Wait time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Code, e.Message)
+}
+
+func (e *StatusError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
+func (o *OpenAICompatible) send(payload []byte) (Result, error) {
+	req, err := http.NewRequestWithContext(o.ctx, "POST", o.endpoint, bytes.NewBuffer(payload))
+	if err != nil {
+		return Result{}, retry.Permanent(fmt.Errorf("create request: %w", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	// local servers usually do not require a key
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		if o.ctx.Err() != nil {
+			return Result{}, retry.Permanent(o.ctx.Err())
+		}
+		return Result{}, fmt.Errorf("send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result Response
+	decodeErr := json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &StatusError{
+			Code:    resp.StatusCode,
+			Message: http.StatusText(resp.StatusCode),
+			Wait:    retry.ParseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		if decodeErr == nil && result.Error != nil {
+			statusErr.Message = result.Error.Message
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return Result{}, statusErr
+		}
+		return Result{}, retry.Permanent(statusErr)
+	}
+	if decodeErr != nil {
+		return Result{}, fmt.Errorf("decode response: %w", decodeErr)
+	}
+	if len(result.Choices) == 0 {
+		return Result{}, fmt.Errorf("no choices in response")
+	}
+	return Result{
+		Content: result.Choices[0].Message.Content,
+		Usage:   result.Usage,
+	}, nil
+}
@@ -0,0 +1,134 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fbngrm/zh-anki/pkg/retry"
+)
+
+func TestOpenAICompatibleRetry(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"rate limit"}}`))
+		default:
+			w.Write([]byte(`{"choices":[{"message":{"content":"{}"}}],"usage":{"total_tokens":42}}`))
+		}
+	}))
+	defer server.Close()
+
+	backoff := retry.Backoff{Attempts: 3, Base: time.Millisecond, Max: time.Millisecond}
+	p := NewOpenAICompatible(context.Background(), Config{BaseURL: server.URL, Backoff: &backoff})
+	result, err := p.Complete(Completion{User: "你好"})
+	if err != nil {
+		t.Fatalf("Complete returned an error: %v", err)
+	}
+	if calls != 2 || result.Usage.TotalTokens != 42 {
+		t.Errorf("Expected success on second call, got %d calls and %+v", calls, result)
+	}
+
+	// client errors are not retried
+	calls = 0
+	badRequest := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":{"message":"invalid model"}}`))
+	}))
+	defer badRequest.Close()
+	p = NewOpenAICompatible(context.Background(), Config{BaseURL: badRequest.URL, Backoff: &backoff})
+	_, err = p.Complete(Completion{User: "你好"})
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.Message != "invalid model" || calls != 1 {
+		t.Errorf("Expected a single bad request, got: %v after %d calls", err, calls)
+	}
+}
+
+func TestRateLimited(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slept time.Duration
+	r := NewRateLimited(context.Background(), &Fake{}, 2, 0)
+	r.now = func() time.Time { return now }
+	r.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	for i := 0; i < 3; i++ {
+		r.reserve(10)
+	}
+	if slept != time.Minute {
+		t.Errorf("Expected the third request to wait a minute, waited: %s", slept)
+	}
+
+	slept = 0
+	r = NewRateLimited(context.Background(), &Fake{}, 0, 1000)
+	r.now = func() time.Time { return now }
+	r.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+	r.reserve(600)
+	now = now.Add(10 * time.Second)
+	r.reserve(600)
+	if slept != 50*time.Second {
+		t.Errorf("Expected to wait until the first request leaves the window, waited: %s", slept)
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte(`{"choices":[{"message":{"content":"{}"}}]}`))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := NewOpenAICompatible(ctx, Config{BaseURL: server.URL})
+	if _, err := p.Complete(Completion{User: "你好"}); !errors.Is(err, context.Canceled) || calls != 0 {
+		t.Errorf("Expected no request after cancel, got: %v after %d calls", err, calls)
+	}
+
+	// waiting requests return once the context is done
+	r := NewRateLimited(ctx, &Fake{}, 1, 0)
+	r.events = []*event{{at: time.Now()}}
+	if _, err := r.Complete(Completion{User: "你好"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the rate limited request to be canceled, got: %v", err)
+	}
+}
+
+func TestMetered(t *testing.T) {
+	prices := map[string]Price{"scripted": {Input: 1e6, Output: 2e6}}
+	ledger := NewLedger("scripted", prices, 25)
+	provider := &scripted{responses: []string{"{}", "{}", "{}"}}
+	m := NewMetered(provider, ledger)
+
+	// each call uses 10 tokens, accounted as prompt tokens by the scripted provider
+	for i := 0; i < 2; i++ {
+		if _, err := m.Complete(Completion{Prompt: wordExamplesPrompt}); err != nil {
+			t.Fatalf("Complete returned an error: %v", err)
+		}
+	}
+	if _, err := m.Complete(Completion{Prompt: sentencePrompt}); err != nil {
+		t.Fatalf("Complete returned an error: %v", err)
+	}
+	if cost := ledger.Cost(); cost != 30 {
+		t.Errorf("Expected cost of 30, got: %f", cost)
+	}
+	if _, err := m.Complete(Completion{Prompt: sentencePrompt}); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("Expected budget to be exceeded, got: %v", err)
+	}
+	if calls := ledger.byPrompt[wordExamplesPrompt].Calls; calls != 2 {
+		t.Errorf("Expected 2 calls for word examples, got: %d", calls)
+	}
+}
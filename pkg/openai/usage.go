@@ -0,0 +1,220 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+	"gopkg.in/yaml.v2"
+)
+
+// ErrBudgetExceeded is returned for new requests once the max cost of a run is reached.
+var ErrBudgetExceeded = errors.New("llm budget exceeded")
+
+// Price in USD per 1M tokens.
+type Price struct {
+	Input  float64 `yaml:"input" json:"input"`
+	Output float64 `yaml:"output" json:"output"`
+}
+
+// DefaultPrices can be extended or overridden with LoadPrices.
+var DefaultPrices = map[string]Price{
+	"gpt-3.5-turbo": {Input: 0.5, Output: 1.5},
+	"gpt-4o-mini":   {Input: 0.15, Output: 0.6},
+	"gpt-4o":        {Input: 2.5, Output: 10},
+	"gpt-4-turbo":   {Input: 10, Output: 30},
+	"fake":          {},
+}
+
+// LoadPrices reads a yaml map of model names to prices and merges it into the defaults.
+func LoadPrices(path string) (map[string]Price, error) {
+	prices := make(map[string]Price, len(DefaultPrices))
+	for k, v := range DefaultPrices {
+		prices[k] = v
+	}
+	if path == "" {
+		return prices, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open price table: %w", err)
+	}
+	var custom map[string]Price
+	if err := yaml.Unmarshal(b, &custom); err != nil {
+		return nil, fmt.Errorf("could not unmarshal price table: %w", err)
+	}
+	for k, v := range custom {
+		prices[k] = v
+	}
+	return prices, nil
+}
+
+// Cost of the usage in USD.
+func (p Price) Cost(u Usage) float64 {
+	return (float64(u.PromptTokens)*p.Input + float64(u.CompletionTokens)*p.Output) / 1e6
+}
+
+// PromptUsage is the usage of a single prompt, e.g. word_examples, during a run.
+type PromptUsage struct {
+	Calls int     `json:"calls"`
+	Usage Usage   `json:"usage"`
+	Cost  float64 `json:"cost"`
+}
+
+// Ledger accounts the token usage and cost of a run. It is shared by all workers.
+type Ledger struct {
+	model   string
+	price   Price
+	priced  bool
+	maxCost float64 // 0 means unlimited
+
+	mu       sync.Mutex
+	byPrompt map[string]*PromptUsage
+}
+
+func NewLedger(model string, prices map[string]Price, maxCost float64) *Ledger {
+	price, ok := prices[model]
+	if !ok {
+		slog.Warn("no price for model, cost is not accounted", "model", model)
+	}
+	return &Ledger{
+		model:    model,
+		price:    price,
+		priced:   ok,
+		maxCost:  maxCost,
+		byPrompt: make(map[string]*PromptUsage),
+	}
+}
+
+func (l *Ledger) Record(prompt string, u Usage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.byPrompt[prompt]
+	if !ok {
+		p = &PromptUsage{}
+		l.byPrompt[prompt] = p
+	}
+	p.Calls++
+	p.Usage.add(u)
+	p.Cost += l.price.Cost(u)
+}
+
+// Cost of the run so far in USD.
+func (l *Ledger) Cost() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cost()
+}
+
+func (l *Ledger) cost() float64 {
+	var cost float64
+	for _, p := range l.byPrompt {
+		cost += p.Cost
+	}
+	return cost
+}
+
+func (l *Ledger) Exceeded() bool {
+	return l.maxCost > 0 && l.Cost() >= l.maxCost
+}
+
+func (l *Ledger) prompts() []string {
+	prompts := make([]string, 0, len(l.byPrompt))
+	for p := range l.byPrompt {
+		prompts = append(prompts, p)
+	}
+	sort.Strings(prompts)
+	return prompts
+}
+
+// Summary is printed at the end of a run.
+func (l *Ledger) Summary() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "llm usage (%s):\n", l.model)
+	var total Usage
+	for _, prompt := range l.prompts() {
+		p := l.byPrompt[prompt]
+		total.add(p.Usage)
+		fmt.Fprintf(&sb, "  %-18s %4d calls %8d prompt %8d completion tokens  $%.4f\n",
+			prompt, p.Calls, p.Usage.PromptTokens, p.Usage.CompletionTokens, p.Cost)
+	}
+	fmt.Fprintf(&sb, "  %-18s %4s       %8d prompt %8d completion tokens  $%.4f", "total", "", total.PromptTokens, total.CompletionTokens, l.cost())
+	if !l.priced {
+		sb.WriteString(" (no price for model)")
+	}
+	return sb.String()
+}
+
+type usageLogEntry struct {
+	Time    time.Time               `json:"time"`
+	Run     string                  `json:"run"`
+	Model   string                  `json:"model"`
+	Prompts map[string]*PromptUsage `json:"prompts"`
+	Cost    float64                 `json:"cost"`
+}
+
+// AppendLog appends the usage of the run as a JSON line to the file at path. Runs
+// without requests are not logged.
+func (l *Ledger) AppendLog(path, run string) error {
+	l.mu.Lock()
+	entry := usageLogEntry{
+		Time:    time.Now().UTC(),
+		Run:     run,
+		Model:   l.model,
+		Prompts: l.byPrompt,
+		Cost:    l.cost(),
+	}
+	b, err := json.Marshal(entry)
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(entry.Prompts) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open usage log: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+// Metered records the usage of all completions in the ledger and stops issuing
+// requests once the budget is exceeded.
+type Metered struct {
+	provider Provider
+	ledger   *Ledger
+}
+
+func NewMetered(provider Provider, ledger *Ledger) *Metered {
+	return &Metered{
+		provider: provider,
+		ledger:   ledger,
+	}
+}
+
+func (m *Metered) Model() string {
+	return m.provider.Model()
+}
+
+func (m *Metered) Complete(c Completion) (Result, error) {
+	if m.ledger.Exceeded() {
+		return Result{}, ErrBudgetExceeded
+	}
+	result, err := m.provider.Complete(c)
+	if err == nil {
+		m.ledger.Record(c.Prompt, result.Usage)
+	}
+	return result, err
+}
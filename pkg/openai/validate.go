@@ -0,0 +1,181 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ValidationError is returned if a response does not match the expected schema.
+type ValidationError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("field %s: %s", e.Field, e.Reason)
+}
+
+// ResponseError is returned if no valid response could be fetched for a query.
+type ResponseError struct {
+	Prompt   string
+	Query    string
+	Attempts int
+	Err      error // the error of the last attempt
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("no valid response for prompt %s and query %q after %d attempts: %v", e.Prompt, e.Query, e.Attempts, e.Err)
+}
+
+func (e *ResponseError) Unwrap() error {
+	return e.Err
+}
+
+// schema is implemented by all types that are decoded from model responses.
+type schema interface {
+	validate() error
+}
+
+// decode strips code fences, decodes the content into out and validates it.
+func decode(content string, out schema) error {
+	if err := json.Unmarshal([]byte(stripCodeFence(content)), out); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return out.validate()
+}
+
+// stripCodeFence removes markdown code fences like ```json ... ``` around the content.
+func stripCodeFence(content string) string {
+	content = strings.TrimSpace(content)
+	if !strings.HasPrefix(content, "```") {
+		return content
+	}
+	// drop the opening fence including the language tag
+	if i := strings.Index(content, "\n"); i != -1 {
+		content = content[i+1:]
+	} else {
+		content = strings.TrimPrefix(content, "```")
+	}
+	content = strings.TrimSpace(content)
+	return strings.TrimSpace(strings.TrimSuffix(content, "```"))
+}
+
+func required(field, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return &ValidationError{Field: field, Reason: "must not be empty"}
+	}
+	return nil
+}
+
+func (w Word) validate(field string) error {
+	if err := required(field+".ch", w.Ch); err != nil {
+		return err
+	}
+	if err := required(field+".en", w.En); err != nil {
+		return err
+	}
+	return required(field+".pi", w.Pi)
+}
+
+func (s *Sentence) validate() error {
+	if err := required("chinese", s.Chinese); err != nil {
+		return err
+	}
+	if err := required("english", s.English); err != nil {
+		return err
+	}
+	if err := required("pinyin", s.Pinyin); err != nil {
+		return err
+	}
+	if len(s.Words) == 0 {
+		return &ValidationError{Field: "words", Reason: "must not be empty"}
+	}
+	for i, w := range s.Words {
+		if err := w.validate(fmt.Sprintf("words[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *ExampleSentences) validate() error {
+	if len(e.Examples) == 0 {
+		return &ValidationError{Field: "examples", Reason: "must not be empty"}
+	}
+	for i, w := range e.Examples {
+		if err := w.validate(fmt.Sprintf("examples[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *WordEntry) validate() error {
+	if err := required("pinyin", e.Pinyin); err != nil {
+		return err
+	}
+	if len(e.Definitions) == 0 {
+		return &ValidationError{Field: "definitions", Reason: "must not be empty"}
+	}
+	for i, c := range e.Chars {
+		if err := c.validate(fmt.Sprintf("chars[%d]", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GrammarNotes) validate() error {
+	if err := required("note", g.Note); err != nil {
+		return err
+	}
+	if err := required("structure", g.Structure); err != nil {
+		return err
+	}
+	if len(g.Summary) == 0 {
+		return &ValidationError{Field: "summary", Reason: "must not be empty"}
+	}
+	return nil
+}
+
+func (d *Dialogue) validate() error {
+	if len(d.Lines) == 0 {
+		return &ValidationError{Field: "lines", Reason: "must not be empty"}
+	}
+	for i, l := range d.Lines {
+		if err := required(fmt.Sprintf("lines[%d].speaker", i), l.Speaker); err != nil {
+			return err
+		}
+		if err := required(fmt.Sprintf("lines[%d].ch", i), l.Chinese); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Decomposition) validate() error {
+	if len(d.Sentences) == 0 {
+		return &ValidationError{Field: "sentences", Reason: "must not be empty"}
+	}
+	for i := range d.Sentences {
+		if err := d.Sentences[i].validate(); err != nil {
+			if v, ok := err.(*ValidationError); ok {
+				return &ValidationError{Field: fmt.Sprintf("sentences[%d].%s", i, v.Field), Reason: v.Reason}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON accepts the sentences wrapped in an object, as requested, or a bare
+// array, which models sometimes return instead.
+func (d *Decomposition) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		return json.Unmarshal(b, &d.Sentences)
+	}
+	type decomposition Decomposition
+	return json.Unmarshal(b, (*decomposition)(d))
+}
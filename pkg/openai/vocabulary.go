@@ -0,0 +1,116 @@
+package openai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const vocabularyKnownMessage = `Each sentence may contain at most %d words that are not in the following list of words the learner knows: %s`
+
+const regenerateMessage = `The following sentences contain words the learner does not know:
+%sReplace these sentences with new ones that use at most %d unknown words. Reply with the complete JSON object only, without any explanation or markdown.`
+
+// max number of known words listed in the prompt
+const maxKnownInPrompt = 500
+
+// Vocabulary limits the words used in example sentences to the words the learner
+// knows, e.g. from the ignore list or anki.
+type Vocabulary struct {
+	Known map[string]struct{}
+	// max number of unknown words per sentence, the word or pattern itself is known
+	MaxUnknown int
+}
+
+// variant is part of the cache key. The known words change with every deck and are
+// checked after the lookup instead. The target hsk level is part of the prompt.
+func (v *Vocabulary) variant() string {
+	return fmt.Sprintf("unknown%d", v.MaxUnknown)
+}
+
+func (v *Vocabulary) instructions() string {
+	if len(v.Known) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(vocabularyKnownMessage, v.MaxUnknown, strings.Join(v.knownWords(), ", "))
+}
+
+// knownWords returns a sorted sample of the known words, words come before characters.
+func (v *Vocabulary) knownWords() []string {
+	words := make([]string, 0, len(v.Known))
+	for w := range v.Known {
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		li, lj := len([]rune(words[i])), len([]rune(words[j]))
+		if li != lj {
+			return li > lj
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > maxKnownInPrompt {
+		words = words[:maxKnownInPrompt]
+	}
+	return words
+}
+
+// rejection is a sentence with too many unknown words.
+type rejection struct {
+	sentence string
+	unknown  []string
+}
+
+// check returns the segmented sentences that contain more than MaxUnknown unknown words.
+func (v *Vocabulary) check(query string, examples []Word) []rejection {
+	// the word or pattern the sentences are about is not counted
+	queried := map[string]struct{}{}
+	for _, w := range hanziRuns(query) {
+		queried[w] = struct{}{}
+	}
+	var rejected []rejection
+	for _, e := range examples {
+		unknown := v.unknown(e.Ch, queried)
+		if len(unknown) > v.MaxUnknown {
+			rejected = append(rejected, rejection{
+				sentence: strings.Join(strings.Fields(e.Ch), ""),
+				unknown:  unknown,
+			})
+		}
+	}
+	return rejected
+}
+
+func (v *Vocabulary) unknown(segmented string, queried map[string]struct{}) []string {
+	var unknown []string
+	for _, word := range strings.Fields(segmented) {
+		for _, w := range hanziRuns(word) {
+			if _, ok := v.Known[w]; ok {
+				continue
+			}
+			if _, ok := queried[w]; ok {
+				continue
+			}
+			unknown = append(unknown, w)
+		}
+	}
+	return unknown
+}
+
+func (v *Vocabulary) regenerateMessage(rejected []rejection) string {
+	var sb strings.Builder
+	for _, r := range rejected {
+		fmt.Fprintf(&sb, "- %s (unknown: %s)\n", r.sentence, strings.Join(r.unknown, ", "))
+	}
+	return fmt.Sprintf(regenerateMessage, sb.String(), v.MaxUnknown)
+}
+
+// hanziRuns splits s into runs of Chinese characters, dropping punctuation, pinyin
+// and placeholders like … in patterns.
+func hanziRuns(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.Is(unicode.Han, r)
+	})
+}
@@ -0,0 +1,195 @@
+package pinyin
+
+import (
+	"strings"
+	"unicode"
+)
+
+// all toneless mandarin syllables, r is used for erhua, e.g. yi1 dian3 r5
+var syllables = toSet(`
+a ai an ang ao
+ba bai ban bang bao bei ben beng bi bian biao bie bin bing bo bu
+ca cai can cang cao ce cen ceng cha chai chan chang chao che chen cheng chi chong chou chu chua chuai chuan chuang chui chun chuo ci cong cou cu cuan cui cun cuo
+da dai dan dang dao de dei den deng di dia dian diao die ding diu dong dou du duan dui dun duo
+e ei en eng er
+fa fan fang fei fen feng fo fou fu
+ga gai gan gang gao ge gei gen geng gong gou gu gua guai guan guang gui gun guo
+ha hai han hang hao he hei hen heng hm hong hou hu hua huai huan huang hui hun huo
+ji jia jian jiang jiao jie jin jing jiong jiu ju juan jue jun
+ka kai kan kang kao ke kei ken keng kong kou ku kua kuai kuan kuang kui kun kuo
+la lai lan lang lao le lei leng li lia lian liang liao lie lin ling liu lo long lou lu luan lun luo lü lüe
+m ma mai man mang mao me mei men meng mi mian miao mie min ming miu mo mou mu
+n na nai nan nang nao ne nei nen neng ng ni nian niang niao nie nin ning niu nong nou nu nuan nun nuo nü nüe
+o ou
+pa pai pan pang pao pei pen peng pi pian piao pie pin ping po pou pu
+qi qia qian qiang qiao qie qin qing qiong qiu qu quan que qun
+r ran rang rao re ren reng ri rong rou ru rua ruan rui run ruo
+sa sai san sang sao se sen seng sha shai shan shang shao she shei shen sheng shi shou shu shua shuai shuan shuang shui shun shuo si song sou su suan sui sun suo
+ta tai tan tang tao te teng ti tian tiao tie ting tong tou tu tuan tui tun tuo
+wa wai wan wang wei wen weng wo wu
+xi xia xian xiang xiao xie xin xing xiong xiu xu xuan xue xun
+ya yan yang yao ye yi yin ying yo yong you yu yuan yue yun
+za zai zan zang zao ze zei zen zeng zha zhai zhan zhang zhao zhe zhei zhen zheng zhi zhong zhou zhu zhua zhuai zhuan zhuang zhui zhun zhuo zi zong zou zu zuan zui zun zuo
+`)
+
+// the longest syllable, e.g. zhuang, has 6 letters
+const maxSyllableLen = 6
+
+func toSet(s string) map[string]struct{} {
+	set := make(map[string]struct{})
+	for _, f := range strings.Fields(s) {
+		set[f] = struct{}{}
+	}
+	return set
+}
+
+var toneOf = map[rune]int{
+	'ā': 1, 'á': 2, 'ǎ': 3, 'à': 4,
+	'ō': 1, 'ó': 2, 'ǒ': 3, 'ò': 4,
+	'ē': 1, 'é': 2, 'ě': 3, 'è': 4,
+	'ī': 1, 'í': 2, 'ǐ': 3, 'ì': 4,
+	'ū': 1, 'ú': 2, 'ǔ': 3, 'ù': 4,
+	'ǖ': 1, 'ǘ': 2, 'ǚ': 3, 'ǜ': 4,
+}
+
+var marked = func() map[rune][5]rune {
+	m := make(map[rune][5]rune)
+	for r, tone := range toneOf {
+		base := toneMarks[r]
+		tones := m[base]
+		tones[0] = base
+		tones[tone] = r
+		m[base] = tones
+	}
+	return m
+}()
+
+// Syllable is a single toneless syllable and its tone, 1-4 or 5 for the neutral tone.
+type Syllable struct {
+	Base string
+	Tone int
+}
+
+// String returns the syllable with tone marks, e.g. hǎo.
+func (s Syllable) String() string {
+	runes := []rune(s.Base)
+	i := markPosition(runes)
+	if i == -1 || s.Tone < 1 || s.Tone > 4 {
+		return s.Base
+	}
+	runes[i] = marked[runes[i]][s.Tone]
+	return string(runes)
+}
+
+// the mark goes on a or e, on the o of ou, otherwise on the last vowel.
+func markPosition(runes []rune) int {
+	last := -1
+	for i, r := range runes {
+		switch r {
+		case 'a', 'e':
+			return i
+		case 'o':
+			if i+1 < len(runes) && runes[i+1] == 'u' {
+				return i
+			}
+			last = i
+		case 'i', 'u', 'ü':
+			last = i
+		}
+	}
+	return last
+}
+
+// Join returns the syllables with tone marks, separated by sep.
+func Join(s []Syllable, sep string) string {
+	parts := make([]string, len(s))
+	for i, syl := range s {
+		parts[i] = syl.String()
+	}
+	return strings.Join(parts, sep)
+}
+
+// ParseSyllables splits pinyin with tone marks, e.g. nǐhǎo, or tone numbers, e.g.
+// ni3 hao3, into syllables. Punctuation and apostrophes are ignored. Returns false if
+// the pinyin contains text that is not a valid syllable.
+func ParseSyllables(s string) ([]Syllable, bool) {
+	s = strings.ToLower(s)
+	s = strings.ReplaceAll(s, "u:", "ü")
+	s = strings.ReplaceAll(s, "v", "ü")
+
+	result := []Syllable{}
+	chunk := []rune{}
+	flush := func(tone int) bool {
+		if len(chunk) == 0 {
+			return true
+		}
+		parsed, ok := segment(chunk)
+		if !ok {
+			return false
+		}
+		// a tone number belongs to the last syllable of the chunk
+		if tone > 0 && parsed[len(parsed)-1].Tone == 5 {
+			parsed[len(parsed)-1].Tone = tone
+		}
+		result = append(result, parsed...)
+		chunk = chunk[:0]
+		return true
+	}
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '5':
+			tone := int(r - '0')
+			if tone == 0 {
+				tone = 5
+			}
+			if !flush(tone) {
+				return nil, false
+			}
+		case unicode.IsLetter(r):
+			chunk = append(chunk, r)
+		default:
+			if !flush(0) {
+				return nil, false
+			}
+		}
+	}
+	if !flush(0) {
+		return nil, false
+	}
+	return result, true
+}
+
+// segment splits letters without separators into syllables, e.g. shuìjiào. The
+// longest syllable is tried first, shorter ones if the rest can not be parsed.
+func segment(chunk []rune) ([]Syllable, bool) {
+	if len(chunk) == 0 {
+		return []Syllable{}, true
+	}
+	for n := min(maxSyllableLen, len(chunk)); n > 0; n-- {
+		syl, ok := toSyllable(chunk[:n])
+		if !ok {
+			continue
+		}
+		rest, ok := segment(chunk[n:])
+		if ok {
+			return append([]Syllable{syl}, rest...), true
+		}
+	}
+	return nil, false
+}
+
+func toSyllable(runes []rune) (Syllable, bool) {
+	tone := 5
+	base := make([]rune, len(runes))
+	for i, r := range runes {
+		if t, ok := toneOf[r]; ok {
+			tone = t
+			r = toneMarks[r]
+		}
+		base[i] = r
+	}
+	if _, ok := syllables[string(base)]; !ok {
+		return Syllable{}, false
+	}
+	return Syllable{Base: string(base), Tone: tone}, true
+}
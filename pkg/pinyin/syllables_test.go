@@ -0,0 +1,39 @@
+package pinyin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSyllables(t *testing.T) {
+	testCases := []struct {
+		pinyin   string
+		expected []Syllable
+	}{
+		{"nǐ hǎo", []Syllable{{"ni", 3}, {"hao", 3}}},
+		{"shuìjiào", []Syllable{{"shui", 4}, {"jiao", 4}}},
+		{"ni3 hao3", []Syllable{{"ni", 3}, {"hao", 3}}},
+		{"Xī'ān", []Syllable{{"xi", 1}, {"an", 1}}},
+		{"lu:4 se4", []Syllable{{"lü", 4}, {"se", 4}}},
+		{"yìdiǎnr", []Syllable{{"yi", 4}, {"dian", 3}, {"r", 5}}},
+		{"xièxie.", []Syllable{{"xie", 4}, {"xie", 5}}},
+		{"fāngàn", []Syllable{{"fang", 1}, {"an", 4}}},
+	}
+	for _, tc := range testCases {
+		result, ok := ParseSyllables(tc.pinyin)
+		if !ok || !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("Unexpected result for %s. Expected: %v, Got: %v", tc.pinyin, tc.expected, result)
+		}
+	}
+
+	if _, ok := ParseSyllables("hello"); ok {
+		t.Errorf("Expected invalid pinyin not to be parsed")
+	}
+}
+
+func TestSyllableString(t *testing.T) {
+	syllables, _ := ParseSyllables("xue2 sheng5 lu:4 zou3 gui4")
+	if s := Join(syllables, " "); s != "xué sheng lǜ zǒu guì" {
+		t.Errorf("Unexpected tone marks: %s", s)
+	}
+}
@@ -0,0 +1,34 @@
+package pinyin
+
+import (
+	"strings"
+	"unicode"
+)
+
+var toneMarks = map[rune]rune{
+	'ā': 'a', 'á': 'a', 'ǎ': 'a', 'à': 'a',
+	'ō': 'o', 'ó': 'o', 'ǒ': 'o', 'ò': 'o',
+	'ē': 'e', 'é': 'e', 'ě': 'e', 'è': 'e',
+	'ī': 'i', 'í': 'i', 'ǐ': 'i', 'ì': 'i',
+	'ū': 'u', 'ú': 'u', 'ǔ': 'u', 'ù': 'u',
+	'ǖ': 'ü', 'ǘ': 'ü', 'ǚ': 'ü', 'ǜ': 'ü',
+}
+
+// Toneless removes tone marks and tone numbers from pinyin, e.g. zài and zai4
+// both become zai. CEDICT's u: and v are normalized to ü.
+func Toneless(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, "u:", "ü")
+	s = strings.ReplaceAll(s, "v", "ü")
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsDigit(r) {
+			continue
+		}
+		if base, ok := toneMarks[r]; ok {
+			r = base
+		}
+		b.WriteRune(r)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,107 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff retries a func with exponentially growing delays.
+type Backoff struct {
+	Attempts int           // max number of calls, including the first one
+	Base     time.Duration // delay after the first failed call
+	Max      time.Duration // upper bound of a single delay, also of the delay sent by the server
+}
+
+var Default = Backoff{
+	Attempts: 5,
+	Base:     time.Second,
+	Max:      time.Minute,
+}
+
+// RetryAfter is implemented by errors that know when to try again, e.g. from a
+// Retry-After header.
+type RetryAfter interface {
+	RetryAfter() time.Duration
+}
+
+type permanent struct {
+	err error
+}
+
+func (p *permanent) Error() string {
+	return p.err.Error()
+}
+
+func (p *permanent) Unwrap() error {
+	return p.err
+}
+
+// Permanent marks an error that should not be retried.
+func Permanent(err error) error {
+	return &permanent{err: err}
+}
+
+// Delay returns the delay after the given failed attempt, starting at 0, with up to
+// 50% jitter so concurrent callers do not retry at the same time.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Base << attempt
+	if d > b.Max || d <= 0 {
+		d = b.Max
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// Do calls f until it succeeds, returns a permanent error, the attempts are used up
+// or the context is done. The last error is returned.
+func (b Backoff) Do(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 0; attempt < max(b.Attempts, 1); attempt++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		var p *permanent
+		if errors.As(err, &p) {
+			return p.err
+		}
+		if attempt == b.Attempts-1 {
+			break
+		}
+		delay := b.Delay(attempt)
+		// the server's delay is capped, so a bogus header can not stall the run
+		var ra RetryAfter
+		if errors.As(err, &ra) && ra.RetryAfter() > 0 {
+			delay = ra.RetryAfter()
+			if b.Max > 0 && delay > b.Max {
+				delay = b.Max
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+// ParseRetryAfter returns the delay of a Retry-After header, which is given in seconds
+// or as http date. Returns 0 if the header is empty or invalid.
+func ParseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,95 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type tooManyRequests struct{}
+
+func (tooManyRequests) Error() string {
+	return "429"
+}
+
+func (tooManyRequests) RetryAfter() time.Duration {
+	return time.Millisecond
+}
+
+func TestDo(t *testing.T) {
+	b := Backoff{Attempts: 3, Base: time.Millisecond, Max: 2 * time.Millisecond}
+
+	calls := 0
+	err := b.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return tooManyRequests{}
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Expected success after 3 calls, got: %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	errBadRequest := errors.New("400")
+	err = b.Do(context.Background(), func() error {
+		calls++
+		return Permanent(errBadRequest)
+	})
+	if !errors.Is(err, errBadRequest) || calls != 1 {
+		t.Errorf("Expected permanent error after 1 call, got: %v after %d calls", err, calls)
+	}
+
+	calls = 0
+	err = b.Do(context.Background(), func() error {
+		calls++
+		return tooManyRequests{}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("Expected error after 3 calls, got: %v after %d calls", err, calls)
+	}
+}
+
+type retryTomorrow struct{}
+
+func (retryTomorrow) Error() string {
+	return "503"
+}
+
+func (retryTomorrow) RetryAfter() time.Duration {
+	return 24 * time.Hour
+}
+
+func TestDoRetryAfterMax(t *testing.T) {
+	b := Backoff{Attempts: 2, Base: time.Millisecond, Max: 10 * time.Millisecond}
+	start := time.Now()
+	calls := 0
+	err := b.Do(context.Background(), func() error {
+		calls++
+		return retryTomorrow{}
+	})
+	if err == nil || calls != 2 {
+		t.Errorf("Expected error after 2 calls, got: %v after %d calls", err, calls)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected the delay to be capped by Max, waited %s", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := ParseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("expected 3s, got %s", d)
+	}
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d := ParseRetryAfter(date); d <= 0 || d > time.Minute {
+		t.Errorf("expected up to a minute, got %s", d)
+	}
+	for _, header := range []string{"", "soon"} {
+		if d := ParseRetryAfter(header); d != 0 {
+			t.Errorf("expected 0 for %q, got %s", header, d)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package strokes
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Entry holds the stroke data of a single character in the Make Me a Hanzi
+// graphics.txt format. Coordinates use a 1024x1024 grid with the y-axis
+// pointing up and the baseline at 900.
+type Entry struct {
+	Character string     `json:"character"`
+	Strokes   []string   `json:"strokes"` // svg path per stroke, in stroke order
+	Medians   [][][2]int `json:"medians"` // points along the center of each stroke
+}
+
+func (e Entry) Count() int {
+	return len(e.Strokes)
+}
+
+func NewDict(src string) (map[string]Entry, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("could not open strokes source file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// lines contain full svg paths and easily exceed the default buffer size
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	dict := make(map[string]Entry)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, fmt.Errorf("could not unmarshal strokes entry: %w", err)
+		}
+		if e.Character == "" || len(e.Strokes) == 0 {
+			continue
+		}
+		dict[e.Character] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return dict, nil
+}
+
+// NewShapeIndex maps each stroke count to the single characters with that number of
+// strokes, sorted by code point. Only characters with the same count can be Similar.
+func NewShapeIndex(dict map[string]Entry) map[int][]string {
+	index := make(map[int][]string)
+	for c, e := range dict {
+		if utf8.RuneCountInString(c) != 1 {
+			continue
+		}
+		index[e.Count()] = append(index[e.Count()], c)
+	}
+	for _, chars := range index {
+		sort.Strings(chars)
+	}
+	return index
+}
+
+// seconds it takes to draw a single stroke in the animated diagram
+const strokeDuration = 0.6
+
+// SVG renders a stroke order diagram with numbered strokes. If animate is
+// true, strokes start in a light gray and are drawn one after another.
+func SVG(e Entry, animate bool) string {
+	var b strings.Builder
+	b.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 1024 1024" width="200" height="200">`)
+	if animate {
+		fmt.Fprintf(&b, `<style>.stroke{fill:#ddd;animation:draw %.1fs ease-in forwards}@keyframes draw{to{fill:#000}}</style>`, strokeDuration)
+	}
+	// the dataset uses a y-axis pointing up, svg uses one pointing down
+	b.WriteString(`<g transform="scale(1, -1) translate(0, -900)">`)
+	for i, stroke := range e.Strokes {
+		if animate {
+			fmt.Fprintf(&b, `<path class="stroke" d="%s" style="animation-delay:%.1fs"/>`, stroke, float64(i)*strokeDuration)
+			continue
+		}
+		fmt.Fprintf(&b, `<path d="%s" fill="#000"/>`, stroke)
+	}
+	b.WriteString(`</g>`)
+	// numbers are placed at the start of each stroke, outside of the flipped group
+	// so that the text is not rendered upside down
+	for i, median := range e.Medians {
+		if len(median) == 0 {
+			continue
+		}
+		x, y := median[0][0], 900-median[0][1]
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="56" fill="#c00">%d</text>`, x, y, i+1)
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// max distance between the start and end points of two strokes to be considered alike
+const maxStrokeDistance = 200
+
+// Similar reports whether two characters have a similar shape. This is the case
+// if they have the same number of strokes and all but one stroke are drawn in
+// the same direction at roughly the same position.
+func Similar(a, b Entry) bool {
+	if a.Count() != b.Count() || len(a.Medians) != len(b.Medians) {
+		return false
+	}
+	mismatches := 0
+	for i := range a.Medians {
+		if !similarStroke(a.Medians[i], b.Medians[i]) {
+			mismatches++
+		}
+		if mismatches > 1 {
+			return false
+		}
+	}
+	// a single stroke character that differs in its only stroke is not similar
+	return mismatches < len(a.Medians)
+}
+
+func similarStroke(a, b [][2]int) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return false
+	}
+	aStart, aEnd := a[0], a[len(a)-1]
+	bStart, bEnd := b[0], b[len(b)-1]
+	if direction(aStart, aEnd) != direction(bStart, bEnd) {
+		return false
+	}
+	return distance(aStart, bStart) < maxStrokeDistance && distance(aEnd, bEnd) < maxStrokeDistance
+}
+
+// direction quantizes the direction from p to q into one of 8 sectors.
+func direction(p, q [2]int) int {
+	angle := math.Atan2(float64(q[1]-p[1]), float64(q[0]-p[0]))
+	sector := int(math.Round(angle/(math.Pi/4))) % 8
+	if sector < 0 {
+		sector += 8
+	}
+	return sector
+}
+
+func distance(p, q [2]int) float64 {
+	return math.Hypot(float64(q[0]-p[0]), float64(q[1]-p[1]))
+}
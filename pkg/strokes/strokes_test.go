@@ -0,0 +1,100 @@
+package strokes
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewDict(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "graphics.txt")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	data := `{"character":"一","strokes":["M 518 382 Z"],"medians":[[[121,393],[905,398]]]}
+{"character":"二","strokes":["M 240 630 Z","M 87 128 Z"],"medians":[[[243,629],[764,660]],[[90,127],[934,139]]]}
+`
+	if _, err := tmpfile.WriteString(data); err != nil {
+		t.Fatalf("Failed to write data to temporary file: %v", err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatalf("Failed to close temporary file: %v", err)
+	}
+
+	dict, err := NewDict(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("NewDict returned an error: %v", err)
+	}
+	if len(dict) != 2 {
+		t.Fatalf("Expected 2 entries, got: %d", len(dict))
+	}
+	if c := dict["二"].Count(); c != 2 {
+		t.Errorf("Expected stroke count 2, got: %d", c)
+	}
+	if _, ok := dict["三"]; ok {
+		t.Errorf("Expected no entry for character missing in the dataset")
+	}
+}
+
+func TestSVG(t *testing.T) {
+	e := Entry{
+		Character: "二",
+		Strokes:   []string{"M 240 630 Z", "M 87 128 Z"},
+		Medians:   [][][2]int{{{243, 629}, {764, 660}}, {{90, 127}, {934, 139}}},
+	}
+
+	static := SVG(e, false)
+	if strings.Contains(static, "@keyframes") {
+		t.Errorf("Expected no animation in static diagram: %s", static)
+	}
+	// the second stroke starts at y=127 in dataset coordinates
+	if !strings.Contains(static, `<text x="90" y="773" font-size="56" fill="#c00">2</text>`) {
+		t.Errorf("Expected stroke number at flipped start of stroke: %s", static)
+	}
+
+	animated := SVG(e, true)
+	if !strings.Contains(animated, "animation-delay:0.6s") {
+		t.Errorf("Expected delayed second stroke: %s", animated)
+	}
+}
+
+func TestSimilar(t *testing.T) {
+	// simplified medians of 己 and 已, which only differ in the start of the last stroke
+	ji := Entry{
+		Strokes: []string{"", "", ""},
+		Medians: [][][2]int{{{250, 700}, {700, 700}, {650, 450}}, {{300, 450}, {700, 450}}, {{300, 600}, {300, 100}, {850, 100}}},
+	}
+	yi := Entry{
+		Strokes: []string{"", "", ""},
+		Medians: [][][2]int{{{250, 700}, {700, 700}, {650, 450}}, {{300, 450}, {700, 450}}, {{300, 450}, {300, 100}, {850, 100}}},
+	}
+	er := Entry{
+		Strokes: []string{"", ""},
+		Medians: [][][2]int{{{243, 629}, {764, 660}}, {{90, 127}, {934, 139}}},
+	}
+	if !Similar(ji, yi) {
+		t.Errorf("Expected similar shapes")
+	}
+	if Similar(ji, er) {
+		t.Errorf("Expected different stroke counts not to be similar")
+	}
+}
+
+func TestNewShapeIndex(t *testing.T) {
+	dict := map[string]Entry{
+		"已": {Strokes: []string{"", "", ""}},
+		"己": {Strokes: []string{"", "", ""}},
+		"巳": {Strokes: []string{"", "", ""}},
+		"二": {Strokes: []string{"", ""}},
+	}
+	index := NewShapeIndex(dict)
+	if got := index[3]; !reflect.DeepEqual(got, []string{"己", "已", "巳"}) {
+		t.Errorf("Expected characters with 3 strokes sorted by code point, got %v", got)
+	}
+	if got := index[2]; !reflect.DeepEqual(got, []string{"二"}) {
+		t.Errorf("Expected characters with 2 strokes, got %v", got)
+	}
+}
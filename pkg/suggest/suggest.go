@@ -0,0 +1,169 @@
+package suggest
+
+import (
+	"sort"
+
+	enc "github.com/fbngrm/zh-anki/pkg/encoding"
+	"github.com/fbngrm/zh-anki/pkg/frequency"
+	"github.com/fbngrm/zh-anki/pkg/hsk"
+)
+
+// words that are not in the frequency index are ranked after all indexed words
+const unranked = 1 << 30
+
+type Suggestion struct {
+	Word     string
+	Unknown  int    // number of unknown characters
+	HSKLevel string // lowest hsk level, empty if the word is not in hsk
+	Rank     int    // frequency rank, 0 if the word is not in the frequency index
+}
+
+type Suggester struct {
+	WordIndex *frequency.WordIndex
+	HSKDict   map[string][]hsk.Entry
+	// only the most frequent words of the index are considered, hsk words are always considered
+	Depth int
+	// words with more unknown characters are not suggested, 1 means i+1 at character level
+	MaxUnknown int
+}
+
+// Suggest returns the next n words to learn. Words whose characters are already known
+// come first, then words with one new character and so on. Words with the same number
+// of unknown characters are ranked by hsk level and then by frequency. Words that are
+// not in hsk get the level of the hsk words of similar frequency, see levelBands.
+func (s *Suggester) Suggest(known map[string]struct{}, n int) []Suggestion {
+	knownChars := make(map[rune]struct{})
+	for k := range known {
+		for _, c := range k {
+			knownChars[c] = struct{}{}
+		}
+	}
+
+	seen := make(map[string]struct{})
+	suggestions := []Suggestion{}
+	add := func(word string) {
+		if _, ok := seen[word]; ok {
+			return
+		}
+		seen[word] = struct{}{}
+		if _, ok := known[word]; ok || !isHanzi(word) {
+			return
+		}
+		unknown := countUnknown(word, knownChars)
+		if unknown > s.MaxUnknown {
+			return
+		}
+		rank, _ := s.WordIndex.Rank(word)
+		suggestions = append(suggestions, Suggestion{
+			Word:     word,
+			Unknown:  unknown,
+			HSKLevel: hsk.LowestLevel(s.HSKDict[word]),
+			Rank:     rank,
+		})
+	}
+
+	for i, word := range s.WordIndex.Words {
+		if i == s.Depth {
+			break
+		}
+		add(word)
+	}
+	for word := range s.HSKDict {
+		add(word)
+	}
+
+	bands := s.levelBands()
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Unknown != b.Unknown {
+			return a.Unknown < b.Unknown
+		}
+		if la, lb := level(a, bands), level(b, bands); la != lb {
+			return la < lb
+		}
+		if ra, rb := rank(a), rank(b); ra != rb {
+			return ra < rb
+		}
+		return a.Word < b.Word
+	})
+
+	if len(suggestions) > n {
+		suggestions = suggestions[:n]
+	}
+	return suggestions
+}
+
+func countUnknown(word string, knownChars map[rune]struct{}) int {
+	unknown := make(map[rune]struct{})
+	for _, c := range word {
+		if _, ok := knownChars[c]; !ok {
+			unknown[c] = struct{}{}
+		}
+	}
+	return len(unknown)
+}
+
+// band is the median frequency rank of the hsk words of a level.
+type band struct {
+	level int
+	rank  int
+}
+
+// levelBands returns the median frequency rank of the hsk words per level, ordered by
+// level. The ranks never decrease, a level with more frequent words than the one below
+// gets the rank of the level below.
+func (s *Suggester) levelBands() []band {
+	ranks := make(map[int][]int)
+	for word, entries := range s.HSKDict {
+		if r, ok := s.WordIndex.Rank(word); ok {
+			l := hsk.MinLevel(hsk.LowestLevel(entries))
+			ranks[l] = append(ranks[l], r)
+		}
+	}
+	bands := make([]band, 0, len(ranks))
+	for l, r := range ranks {
+		sort.Ints(r)
+		bands = append(bands, band{level: l, rank: r[len(r)/2]})
+	}
+	sort.Slice(bands, func(i, j int) bool { return bands[i].level < bands[j].level })
+	for i := 1; i < len(bands); i++ {
+		bands[i].rank = max(bands[i].rank, bands[i-1].rank)
+	}
+	return bands
+}
+
+// words that are not in hsk get the first level whose median rank they reach, less
+// frequent and unranked words come after all hsk levels.
+func level(s Suggestion, bands []band) int {
+	if s.HSKLevel != "" {
+		return hsk.MinLevel(s.HSKLevel)
+	}
+	if s.Rank == 0 {
+		return unranked
+	}
+	for _, b := range bands {
+		if s.Rank <= b.rank {
+			return b.level
+		}
+	}
+	return unranked
+}
+
+func rank(s Suggestion) int {
+	if s.Rank == 0 {
+		return unranked
+	}
+	return s.Rank
+}
+
+func isHanzi(word string) bool {
+	if word == "" {
+		return false
+	}
+	for _, c := range word {
+		if enc.DetectRuneType(c) != enc.RuneType_CJKUnifiedIdeograph {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+package suggest
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/fbngrm/zh-anki/pkg/frequency"
+	"github.com/fbngrm/zh-anki/pkg/hsk"
+)
+
+func TestSuggest(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "wordfreq.txt")
+	if err != nil {
+		t.Fatalf("Failed to create temporary file: %v", err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	data := "的:500\n我们:400\n你们:300\n大学:200\n他们:100\n学生:50\n"
+	if _, err := tmpfile.WriteString(data); err != nil {
+		t.Fatalf("Failed to write data to temporary file: %v", err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		t.Fatalf("Failed to close temporary file: %v", err)
+	}
+	wi, err := frequency.NewWordIndex(tmpfile.Name())
+	if err != nil {
+		t.Fatalf("NewWordIndex returned an error: %v", err)
+	}
+
+	s := Suggester{
+		WordIndex: wi,
+		HSKDict: map[string][]hsk.Entry{
+			"他们": {{Ch: "他们", Level: "1"}},
+			"学生": {{Ch: "学生", Level: "1"}},
+		},
+		Depth:      100,
+		MaxUnknown: 1,
+	}
+	known := map[string]struct{}{"的": {}, "我们": {}, "你": {}, "学": {}}
+
+	var words []string
+	for _, sg := range s.Suggest(known, 10) {
+		words = append(words, sg.Word)
+	}
+	// 你们 only contains known chars, 大学 is not in hsk but as frequent as the words
+	// of level 1
+	expected := []string{"你们", "大学", "他们", "学生"}
+	if !reflect.DeepEqual(words, expected) {
+		t.Errorf("Unexpected suggestions. Expected: %v, Got: %v", expected, words)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	bands := []band{{level: 1, rank: 500}, {level: 2, rank: 1500}, {level: 3, rank: 3000}}
+	testCases := []struct {
+		suggestion Suggestion
+		expected   int
+	}{
+		{Suggestion{HSKLevel: "2", Rank: 100}, 2},
+		{Suggestion{HSKLevel: "7-9"}, 7},
+		{Suggestion{Rank: 100}, 1},
+		{Suggestion{Rank: 1500}, 2},
+		{Suggestion{Rank: 2000}, 3},
+		{Suggestion{Rank: 5000}, unranked},
+		{Suggestion{}, unranked},
+	}
+	for _, tc := range testCases {
+		if got := level(tc.suggestion, bands); got != tc.expected {
+			t.Errorf("%+v: expected level %d, got %d", tc.suggestion, tc.expected, got)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package template
 
 import (
 	"bytes"
+	"io/fs"
 	"strings"
 	"text/template"
 )
@@ -9,6 +10,9 @@ import (
 type Processor struct {
 	funcMap  template.FuncMap
 	tmplPath string
+	// templates are read from fsys if set, e.g. embedded defaults
+	fsys     fs.FS
+	patterns []string
 }
 
 func NewProcessor(deckname, path string, tags []string) *Processor {
@@ -37,8 +41,23 @@ func NewProcessor(deckname, path string, tags []string) *Processor {
 	}
 }
 
+// NewFSProcessor returns a processor for the templates in fsys matching the patterns,
+// e.g. *.tmpl.
+func NewFSProcessor(fsys fs.FS, patterns ...string) *Processor {
+	return &Processor{
+		fsys:     fsys,
+		patterns: patterns,
+	}
+}
+
 func (p *Processor) Fill(a any, templateName string) (string, error) {
-	tmpl, err := template.New(templateName).Funcs(p.funcMap).ParseGlob(p.tmplPath)
+	tmpl := template.New(templateName).Funcs(p.funcMap)
+	var err error
+	if p.fsys != nil {
+		tmpl, err = tmpl.ParseFS(p.fsys, p.patterns...)
+	} else {
+		tmpl, err = tmpl.ParseGlob(p.tmplPath)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,286 @@
+package verify
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fbngrm/zh-anki/pkg/cedict"
+	enc "github.com/fbngrm/zh-anki/pkg/encoding"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+	"github.com/fbngrm/zh-anki/pkg/pinyin"
+)
+
+// Issue is a word whose pinyin or segmentation does not match CEDICT.
+type Issue struct {
+	Sentence string
+	Word     string
+	Pinyin   string   // pinyin returned by the LLM
+	Readings []string // readings in CEDICT
+	Reason   string
+	// the pinyin was replaced with the only matching reading
+	Corrected bool
+}
+
+func (i Issue) String() string {
+	s := fmt.Sprintf("%s\t%s\t%s\t%s\t%s", i.Sentence, i.Word, i.Pinyin, strings.Join(i.Readings, " / "), i.Reason)
+	if i.Corrected {
+		s += " (corrected)"
+	}
+	return s
+}
+
+// Verifier cross-checks the pinyin and segmentation of decomposed sentences against
+// CEDICT. It collects the issues of all sentences of a run and is safe for concurrent use.
+type Verifier struct {
+	dict map[string][]cedict.Entry
+
+	mu     sync.Mutex
+	issues []Issue
+}
+
+func NewVerifier(dict map[string][]cedict.Entry) *Verifier {
+	return &Verifier{dict: dict}
+}
+
+// Sentence checks all words of the sentence and corrects unambiguous pinyin in place.
+// Corrections are applied to the pinyin of the sentence too, words that can not be
+// found in it are reported.
+func (v *Verifier) Sentence(s *openai.Sentence) []Issue {
+	var issues []Issue
+	if words := joinWords(s.Words); words != stripPunctuation(s.Chinese) {
+		issues = append(issues, Issue{
+			Sentence: s.Chinese,
+			Word:     words,
+			Reason:   "words do not match the sentence",
+		})
+	}
+	// words are searched in order, so a repeated word is replaced at its position
+	pos := 0
+	for i := range s.Words {
+		issue, ok := v.word(&s.Words[i])
+		if !ok {
+			continue
+		}
+		issue.Sentence = s.Chinese
+		if issue.Corrected {
+			var replaced bool
+			s.Pinyin, pos, replaced = replacePinyin(s.Pinyin, pos, issue.Pinyin, s.Words[i].Pi)
+			if !replaced {
+				issue.Reason += ", sentence pinyin not corrected"
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	v.mu.Lock()
+	v.issues = append(v.issues, issues...)
+	v.mu.Unlock()
+	return issues
+}
+
+func (v *Verifier) word(w *openai.Word) (Issue, bool) {
+	hanzi := countHanzi(w.Ch)
+	if hanzi == 0 {
+		return Issue{}, false
+	}
+	issue := Issue{
+		Word:   w.Ch,
+		Pinyin: w.Pi,
+	}
+
+	entries := v.dict[w.Ch]
+	readings := []string{}
+	candidates := [][]pinyin.Syllable{}
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if seen[e.Readings] {
+			continue
+		}
+		seen[e.Readings] = true
+		readings = append(readings, e.Readings)
+		if syllables, ok := pinyin.ParseSyllables(e.Readings); ok && len(syllables) == hanzi {
+			candidates = append(candidates, syllables)
+		}
+	}
+	issue.Readings = readings
+
+	syllables, ok := pinyin.ParseSyllables(w.Pi)
+	switch {
+	case len(entries) == 0 && hanzi > 1:
+		issue.Reason = "not in cedict, check segmentation"
+		return issue, true
+	case len(entries) == 0:
+		// single characters missing from CEDICT are rare, e.g. variants, and can not be checked
+		return Issue{}, false
+	case !ok:
+		issue.Reason = "invalid pinyin"
+	case len(syllables) != hanzi:
+		issue.Reason = fmt.Sprintf("%d syllables for %d hanzi", len(syllables), hanzi)
+	default:
+		for _, c := range candidates {
+			if matches([]rune(w.Ch), syllables, c) {
+				return Issue{}, false
+			}
+		}
+		issue.Reason = "pinyin not in cedict"
+	}
+
+	// correct if only one reading has the same syllables or if there is only one reading
+	if corrected, ok := pick(syllables, candidates); ok {
+		sep := ""
+		if strings.Contains(strings.TrimSpace(w.Pi), " ") {
+			sep = " "
+		}
+		w.Pi = pinyin.Join(corrected, sep)
+		issue.Corrected = true
+	}
+	return issue, true
+}
+
+// replacePinyin replaces the first occurrence of old at or after from in the pinyin of
+// a sentence, ignoring case and the spaces between syllables. The capital of the first
+// word is kept. Returns the end of the replacement.
+func replacePinyin(sentence string, from int, old, new string) (string, int, bool) {
+	lower := strings.ToLower(sentence)
+	// byte offsets of lower are only valid for sentence if the case mapping keeps the length
+	if len(lower) != len(sentence) || from > len(sentence) {
+		return sentence, from, false
+	}
+	for _, r := range []struct{ old, new string }{
+		{old, new},
+		{strings.ReplaceAll(old, " ", ""), strings.ReplaceAll(new, " ", "")},
+	} {
+		if strings.TrimSpace(r.old) == "" {
+			continue
+		}
+		needle := strings.ToLower(r.old)
+		i := strings.Index(lower[from:], needle)
+		if i == -1 {
+			continue
+		}
+		i += from
+		replacement := r.new
+		if first, _ := utf8.DecodeRuneInString(sentence[i:]); unicode.IsUpper(first) {
+			replacement = capitalize(replacement)
+		}
+		return sentence[:i] + replacement + sentence[i+len(needle):], i + len(replacement), true
+	}
+	return sentence, from, false
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+func pick(syllables []pinyin.Syllable, candidates [][]pinyin.Syllable) ([]pinyin.Syllable, bool) {
+	if len(candidates) == 1 {
+		return candidates[0], true
+	}
+	var match []pinyin.Syllable
+	n := 0
+	for _, c := range candidates {
+		if sameBases(syllables, c) {
+			match = c
+			n++
+		}
+	}
+	return match, n == 1
+}
+
+func sameBases(a, b []pinyin.Syllable) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Base != b[i].Base {
+			return false
+		}
+	}
+	return true
+}
+
+// matches compares the syllables of the LLM with a CEDICT reading. Neutral tones and
+// the tone sandhi of 一 and 不 are accepted.
+func matches(hanzi []rune, got, want []pinyin.Syllable) bool {
+	if !sameBases(got, want) {
+		return false
+	}
+	for i := range got {
+		if got[i].Tone == want[i].Tone || got[i].Tone == 5 || want[i].Tone == 5 {
+			continue
+		}
+		if i < len(hanzi) && (hanzi[i] == '一' || hanzi[i] == '不') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func countHanzi(s string) int {
+	n := 0
+	for _, r := range s {
+		if enc.DetectRuneType(r) == enc.RuneType_CJKUnifiedIdeograph {
+			n++
+		}
+	}
+	return n
+}
+
+func joinWords(words []openai.Word) string {
+	var sb strings.Builder
+	for _, w := range words {
+		sb.WriteString(stripPunctuation(w.Ch))
+	}
+	return sb.String()
+}
+
+func stripPunctuation(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Polyphonic returns true if a character of word has several readings in CEDICT, e.g.
+// 行 in 银行.
+func (v *Verifier) Polyphonic(word string) bool {
+	for _, r := range word {
+		readings := map[string]struct{}{}
+		for _, e := range v.dict[string(r)] {
+			readings[strings.ToLower(e.Readings)] = struct{}{}
+		}
+		if len(readings) > 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// Issues of all sentences verified so far.
+func (v *Verifier) Issues() []Issue {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]Issue{}, v.issues...)
+}
+
+// WriteReport writes one tab separated line per issue to path.
+func (v *Verifier) WriteReport(path string) error {
+	var sb strings.Builder
+	sb.WriteString("sentence\tword\tpinyin\tcedict\treason\n")
+	for _, i := range v.Issues() {
+		sb.WriteString(i.String())
+		sb.WriteString("\n")
+	}
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("could not write pinyin report: %w", err)
+	}
+	return nil
+}
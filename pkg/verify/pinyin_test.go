@@ -0,0 +1,107 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/fbngrm/zh-anki/pkg/cedict"
+	"github.com/fbngrm/zh-anki/pkg/openai"
+)
+
+var dict = map[string][]cedict.Entry{
+	"你好": {{Simplified: "你好", Readings: "ni3 hao3"}},
+	"我":  {{Simplified: "我", Readings: "wo3"}},
+	"是":  {{Simplified: "是", Readings: "shi4"}},
+	"学生": {{Simplified: "学生", Readings: "xue2 sheng5"}},
+	"一下": {{Simplified: "一下", Readings: "yi1 xia4"}},
+	"行":  {{Simplified: "行", Readings: "hang2"}, {Simplified: "行", Readings: "xing2"}},
+}
+
+func TestVerifierSentence(t *testing.T) {
+	v := NewVerifier(dict)
+	s := openai.Sentence{
+		Chinese: "你好，我是学生一下行行。",
+		Pinyin:  "Nǐhǎo, wǒ shí xuésheng yíxià xíng héng.",
+		Words: []openai.Word{
+			{Ch: "你好", Pi: "nǐhǎo"},
+			{Ch: "我", Pi: "wǒ"},
+			{Ch: "是", Pi: "shí"},        // wrong tone, corrected
+			{Ch: "学生", Pi: "xué shēng"}, // neutral tone in cedict
+			{Ch: "一下", Pi: "yí xià"},    // tone sandhi
+			{Ch: "行", Pi: "xíng"},       // one of several readings
+			{Ch: "行", Pi: "héng"},       // no matching reading, only reported
+		},
+	}
+	issues := v.Sentence(&s)
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %v", issues)
+	}
+	if !issues[0].Corrected || s.Words[2].Pi != "shì" {
+		t.Errorf("Expected pinyin to be corrected, got %s", s.Words[2].Pi)
+	}
+	if issues[1].Corrected || s.Words[6].Pi != "héng" {
+		t.Errorf("Expected ambiguous pinyin not to be corrected, got %s", s.Words[6].Pi)
+	}
+	if s.Pinyin != "Nǐhǎo, wǒ shì xuésheng yíxià xíng héng." {
+		t.Errorf("Expected the sentence pinyin to be corrected, got %s", s.Pinyin)
+	}
+}
+
+func TestReplacePinyin(t *testing.T) {
+	testCases := []struct {
+		sentence string
+		from     int
+		old, new string
+		expected string
+		replaced bool
+	}{
+		{sentence: "Shí de.", old: "shí", new: "shì", expected: "Shì de.", replaced: true},
+		{sentence: "Wǒ xǐhuān nǐ.", old: "xǐ huān", new: "xǐ huan", expected: "Wǒ xǐhuan nǐ.", replaced: true},
+		{sentence: "hǎo hǎo", from: 4, old: "hǎo", new: "hào", expected: "hǎo hào", replaced: true},
+		{sentence: "Nǐ hǎo.", old: "shí", new: "shì", expected: "Nǐ hǎo.", replaced: false},
+		{sentence: "", old: "shí", new: "shì", expected: "", replaced: false},
+	}
+	for _, tc := range testCases {
+		got, _, replaced := replacePinyin(tc.sentence, tc.from, tc.old, tc.new)
+		if got != tc.expected || replaced != tc.replaced {
+			t.Errorf("%q: expected %q (%t), got %q (%t)", tc.sentence, tc.expected, tc.replaced, got, replaced)
+		}
+	}
+}
+
+func TestVerifierSegmentation(t *testing.T) {
+	v := NewVerifier(dict)
+	s := openai.Sentence{
+		Chinese: "我是学生",
+		Words: []openai.Word{
+			{Ch: "我是", Pi: "wǒ shì"},
+			{Ch: "学", Pi: "xué"},
+		},
+	}
+	issues := v.Sentence(&s)
+	if len(issues) != 2 {
+		t.Fatalf("Expected 2 issues, got %v", issues)
+	}
+	if issues[0].Reason != "words do not match the sentence" {
+		t.Errorf("Unexpected reason: %s", issues[0].Reason)
+	}
+	if issues[1].Reason != "not in cedict, check segmentation" {
+		t.Errorf("Unexpected reason: %s", issues[1].Reason)
+	}
+	if len(v.Issues()) != 2 {
+		t.Errorf("Expected issues to be collected")
+	}
+}
+
+func TestVerifierPolyphonic(t *testing.T) {
+	v := NewVerifier(dict)
+	for word, want := range map[string]bool{
+		"银行": true,
+		"行":  true,
+		"我是": false,
+		"你好": false, // only the word is in the dict
+	} {
+		if got := v.Polyphonic(word); got != want {
+			t.Errorf("%s: expected %v, got %v", word, want, got)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package worker
+
+import "sync"
+
+// Map calls f for each element of in, using at most n goroutines, and returns the
+// results in the order of in. With n <= 1 all elements are processed sequentially.
+func Map[T, R any](in []T, n int, f func(T) R) []R {
+	out := make([]R, len(in))
+	if n <= 1 {
+		for i, e := range in {
+			out[i] = f(e)
+		}
+		return out
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n && w < len(in); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out[i] = f(in[i])
+			}
+		}()
+	}
+	for i := range in {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return out
+}
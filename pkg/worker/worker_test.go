@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMap(t *testing.T) {
+	in := []int{5, 1, 4, 2, 3}
+	var running, maxRunning int32
+	out := Map(in, 2, func(i int) int {
+		r := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if r <= m || atomic.CompareAndSwapInt32(&maxRunning, m, r) {
+				break
+			}
+		}
+		// later elements finish first
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return i * 10
+	})
+
+	expected := []int{50, 10, 40, 20, 30}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Unexpected order. Expected: %v, Got: %v", expected, out)
+	}
+	if maxRunning > 2 {
+		t.Errorf("Expected at most 2 concurrent calls, got: %d", maxRunning)
+	}
+}